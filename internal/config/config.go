@@ -1,46 +1,539 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
 	"github.com/porridge/calendar-stats/internal/core"
 )
 
+// Config is the configuration read from a file.
+type Config struct {
+	Categories []*core.Category
+	// Stretch lists rules for stretching events, core.DefaultStretchRules unless configured.
+	Stretch []core.StretchRule
+	// Dimensions list ways of tagging events independently of categories.
+	Dimensions []*core.Dimension
+	// DescriptionTags is true if inline tags should be looked for in event descriptions too.
+	DescriptionTags bool
+	// Policy decides which events are counted.
+	Policy core.Policy
+	// AllDay is the rule for counting all-day and out of office events, nil if they are not counted.
+	AllDay *core.AllDayRule
+	// WorkingDays are the configured working days, empty for the default ones.
+	WorkingDays []time.Weekday
+	// Schedule is the expected working time, nil if not configured.
+	Schedule *core.Schedule
+	// Switching tells which days have switched between categories too often.
+	Switching core.SwitchingThresholds
+	// InternalDomains are email domains of your organization, for meeting statistics.
+	InternalDomains []string
+}
+
+// Default returns the configuration used when there is no configuration file.
+func Default() *Config {
+	return &Config{Stretch: core.DefaultStretchRules}
+}
+
 type config struct {
-	Categories []categoryConfig `yaml:"categories"`
+	Categories []categoryConfig  `yaml:"categories"`
+	Stretch    *[]stretchConfig  `yaml:"stretch"`
+	Dimensions []dimensionConfig `yaml:"dimensions"`
+	InlineTags inlineTagsConfig  `yaml:"inline_tags"`
+	Include    includeConfig     `yaml:"include"`
+	AllDay     *allDayConfig     `yaml:"all_day"`
+	// WorkingDays are names of days of the week, such as "monday" or "mon".
+	WorkingDays  []string            `yaml:"working_days"`
+	WorkingHours *workingHoursConfig `yaml:"working_hours"`
+	Switching    switchingConfig     `yaml:"switching"`
+	Meetings     meetingsConfig      `yaml:"meetings"`
+}
+
+type meetingsConfig struct {
+	// InternalDomains are email domains of your organization. Attendees from other domains are external.
+	InternalDomains []string `yaml:"internal_domains"`
+}
+
+// switchingConfig holds thresholds for flagging choppy days. Thresholds which are not set are not checked.
+type switchingConfig struct {
+	MaxSwitches       int     `yaml:"max_switches"`
+	MinAverageStretch string  `yaml:"min_average_stretch"`
+	MaxFragmentation  float64 `yaml:"max_fragmentation"`
+}
+
+// allDayConfig counts all-day events and out of office entries as a fixed time on each working day.
+type allDayConfig struct {
+	Duration string `yaml:"duration"`
+	Category string `yaml:"category"`
+	// Match optionally limits the rule to events matching any of these rules.
+	Match []matchConfig `yaml:"match"`
+}
+
+// includeConfig tells which events are counted. Settings which are not present keep their default values.
+type includeConfig struct {
+	Tentative       *bool `yaml:"tentative"`
+	Unanswered      *bool `yaml:"unanswered"`
+	FocusTime       *bool `yaml:"focus_time"`
+	Transparent     *bool `yaml:"transparent"`
+	OutOfOffice     *bool `yaml:"out_of_office"`
+	WorkingLocation *bool `yaml:"working_location"`
+}
+
+func (ic *includeConfig) toPolicy() core.Policy {
+	var p core.Policy
+	set := func(v *bool, field *bool, negate bool) {
+		if v != nil {
+			*field = *v != negate
+		}
+	}
+	set(ic.Tentative, &p.Tentative, false)
+	set(ic.Unanswered, &p.Unanswered, false)
+	set(ic.FocusTime, &p.SkipFocusTime, true)
+	set(ic.Transparent, &p.SkipTransparent, true)
+	set(ic.OutOfOffice, &p.OutOfOffice, false)
+	set(ic.WorkingLocation, &p.WorkingLocation, false)
+	return p
+}
+
+// inlineTagsConfig controls where #hashtags and [bracketed] tags are looked for.
+type inlineTagsConfig struct {
+	// Descriptions makes tags be looked for in event descriptions, in addition to summaries.
+	Descriptions bool `yaml:"descriptions"`
+}
+
+type dimensionConfig struct {
+	Name string `yaml:"name"`
+	// Tags are defined the same way as categories.
+	Tags []categoryConfig `yaml:"tags"`
 }
 
 type categoryConfig struct {
 	Name  string        `yaml:"name"`
 	Match []matchConfig `yaml:"match"`
+	// Categories are children of this category. Their names are prefixed with the name of this one.
+	Categories []categoryConfig `yaml:"categories"`
 }
 
+// matchConfig is a rule which matches events satisfying all of its conditions.
+// Empty conditions are ignored.
 type matchConfig struct {
+	// Regex is matched against the summary, same as Summary.
 	Regex string `yaml:"re"`
+	// NotRegex must not match the summary.
+	NotRegex string `yaml:"not_re"`
+	// These are regular expressions.
+	Summary     string `yaml:"summary"`
+	Description string `yaml:"description"`
+	Location    string `yaml:"location"`
+	Organizer   string `yaml:"organizer"`
+	Attendee    string `yaml:"attendee"`
+	// These are exact values, compared ignoring case.
+	Color           string `yaml:"color"`
+	Type            string `yaml:"type"`
+	Calendar        string `yaml:"calendar"`
+	OrganizerDomain string `yaml:"organizer_domain"`
+	AttendeeDomain  string `yaml:"attendee_domain"`
+	// Tag is an inline tag, such as "billable" for events with "#billable" in the summary.
+	Tag string `yaml:"tag"`
+	// These are exclusive bounds of the scheduled duration.
+	LongerThan  string `yaml:"longer_than"`
+	ShorterThan string `yaml:"shorter_than"`
+	// All, Any and Not combine nested rules.
+	All []matchConfig `yaml:"all"`
+	Any []matchConfig `yaml:"any"`
+	Not *matchConfig  `yaml:"not"`
 }
 
-func Read(fileName string) ([]*core.Category, error) {
-	c := &config{}
+type stretchConfig struct {
+	// Duration is the exact duration of matching events, a shortcut for setting Min and Max to the same value.
+	Duration string `yaml:"duration"`
+	Min      string `yaml:"min"`
+	Max      string `yaml:"max"`
+	To       string `yaml:"to"`
+	Category string `yaml:"category"`
+	Calendar string `yaml:"calendar"`
+}
+
+// Read reads and validates the configuration file. All problems found are reported
+// together, each prefixed with the file name, line and column where it was found.
+func Read(fileName string) (*Config, error) {
 	data, err := os.ReadFile(fileName)
 	if err != nil {
 		return nil, err
 	}
-	err = yaml.Unmarshal(data, c)
+	c := &config{}
+	err = yaml.UnmarshalWithOptions(data, c, yaml.Strict())
 	if err != nil {
-		return nil, err
+		return nil, locate(fileName, data, err)
 	}
-	var ret []*core.Category
-	for _, cc := range c.Categories {
-		var pp []*regexp.Regexp
-		for _, p := range cc.Match {
-			pp = append(pp, regexp.MustCompile(p.Regex))
+	ret := Default()
+	ret.DescriptionTags = c.InlineTags.Descriptions
+	ret.Policy = c.Include.toPolicy()
+	cp := &compiler{fileName: fileName, data: data, inlineTags: core.InlineTagsField(ret.DescriptionTags)}
+	categoryNames := make(map[core.CategoryName]bool)
+	for i := range c.Categories {
+		ret.Categories = append(ret.Categories, cp.categories("", "category", "", fmt.Sprintf("$.categories[%d]", i), &c.Categories[i], categoryNames)...)
+	}
+	ret.Categories = childrenFirst(ret.Categories)
+	dimensionNames := make(map[string]bool)
+	for i, dc := range c.Dimensions {
+		path := fmt.Sprintf("$.dimensions[%d]", i)
+		if dc.Name == "" {
+			cp.problem(errorAt(path, "dimension %d has no name", i+1))
+			continue
+		}
+		if dimensionNames[dc.Name] {
+			cp.problem(errorAt(path+".name", "duplicate dimension %q", dc.Name))
+		}
+		dimensionNames[dc.Name] = true
+		dimension := &core.Dimension{Name: dc.Name}
+		tagNames := make(map[core.CategoryName]bool)
+		for j := range dc.Tags {
+			prefix := fmt.Sprintf("dimension %q: ", dc.Name)
+			dimension.Tags = append(dimension.Tags, cp.categories(prefix, "tag", "", fmt.Sprintf("%s.tags[%d]", path, j), &dc.Tags[j], tagNames)...)
+		}
+		dimension.Tags = childrenFirst(dimension.Tags)
+		ret.Dimensions = append(ret.Dimensions, dimension)
+	}
+	if c.Stretch != nil {
+		ret.Stretch = []core.StretchRule{}
+		for i, sc := range *c.Stretch {
+			path := fmt.Sprintf("$.stretch[%d]", i)
+			rule, err := sc.toRule()
+			if err != nil {
+				cp.problem(&pathError{path: path, err: fmt.Errorf("stretch rule %d: %w", i+1, err)})
+				continue
+			}
+			// A parent category without rules of its own is fine, it stands for its descendants.
+			if rule.Category != "" && !slices.ContainsFunc(ret.Categories, func(c *core.Category) bool { return c.Name.Within(rule.Category) }) {
+				cp.problem(errorAt(path+".category", "stretch rule %d: unknown category %q", i+1, sc.Category))
+				continue
+			}
+			ret.Stretch = append(ret.Stretch, rule)
+		}
+	}
+	for i, name := range c.WorkingDays {
+		day, ok := parseWeekday(name)
+		if !ok {
+			cp.problem(errorAt(fmt.Sprintf("$.working_days[%d]", i), "unknown day of the week %q", name))
+			continue
+		}
+		ret.WorkingDays = append(ret.WorkingDays, day)
+	}
+	if c.WorkingHours != nil {
+		if len(c.WorkingDays) > 0 {
+			cp.problem(errorAt("$.working_days", "working_days cannot be used together with working_hours, which tells the working days too"))
 		}
-		ret = append(ret, &core.Category{
-			Name:     core.CategoryName(cc.Name),
-			Patterns: pp,
-		})
+		ret.Schedule = cp.schedule("$.working_hours", c.WorkingHours)
+	}
+	ret.InternalDomains = c.Meetings.InternalDomains
+	ret.Switching = core.SwitchingThresholds{MaxSwitches: c.Switching.MaxSwitches, MaxFragmentation: c.Switching.MaxFragmentation}
+	if c.Switching.MinAverageStretch != "" {
+		d, err := time.ParseDuration(c.Switching.MinAverageStretch)
+		if err != nil {
+			cp.problem(errorAt("$.switching.min_average_stretch", "switching: invalid min_average_stretch: %w", err))
+		}
+		ret.Switching.MinAverageStretch = d
+	}
+	if c.AllDay != nil {
+		ret.AllDay = cp.allDay(c.AllDay, ret.Categories)
+	}
+	if len(cp.problems) > 0 {
+		return nil, errors.Join(cp.problems...)
 	}
 	return ret, nil
 }
+
+// compiler turns configuration read from YAML into core types, collecting problems on the way.
+type compiler struct {
+	fileName   string
+	data       []byte
+	inlineTags core.Field
+	problems   []error
+	// file is the parsed data, used to find positions of rules.
+	file *ast.File
+}
+
+func (cp *compiler) problem(err error) {
+	cp.problems = append(cp.problems, locate(cp.fileName, cp.data, err))
+}
+
+// origin describes the place in the configuration file found at the given YAMLPath.
+func (cp *compiler) origin(path string) string {
+	if cp.file == nil {
+		// Parsing cannot fail, since the same data was decoded successfully before.
+		cp.file, _ = parser.ParseBytes(cp.data, 0)
+	}
+	if cp.file != nil {
+		if line, column, ok := positionIn(cp.file, path); ok {
+			return fmt.Sprintf("%s:%d:%d %s", cp.fileName, line, column, path)
+		}
+	}
+	return fmt.Sprintf("%s %s", cp.fileName, path)
+}
+
+// categories returns the category (or tag, as told by kind) found at the given YAMLPath,
+// followed by its descendants, in order of appearance. Categories which only group their children are omitted.
+// Names of the category and its descendants are added to names, to detect duplicates.
+// Problems are reported with the given prefix.
+func (cp *compiler) categories(prefix, kind string, parent core.CategoryName, path string, cc *categoryConfig, names map[core.CategoryName]bool) []*core.Category {
+	if cc.Name == "" {
+		if parent == core.Uncategorized {
+			cp.problem(errorAt(path, "%s%s has no name", prefix, kind))
+		} else {
+			cp.problem(errorAt(path, "%s%s %q: child %s has no name", prefix, kind, parent, kind))
+		}
+		return nil
+	}
+	name := core.CategoryName(cc.Name)
+	if parent != core.Uncategorized {
+		name = parent + core.CategorySeparator + name
+	}
+	if names[name] {
+		cp.problem(errorAt(path+".name", "%sduplicate %s %q", prefix, kind, name))
+	}
+	names[name] = true
+	var ret []*core.Category
+	if len(cc.Match) > 0 || len(cc.Categories) == 0 {
+		category := &core.Category{Name: name}
+		for i, mc := range cc.Match {
+			rulePath := fmt.Sprintf("%s.match[%d]", path, i)
+			rule, err := mc.toMatcher(rulePath, cp.inlineTags)
+			if err != nil {
+				cp.problem(fmt.Errorf("%s%s %q: match rule %d: %w", prefix, kind, name, i+1, err))
+				continue
+			}
+			category.Rules = append(category.Rules, &core.Rule{Matcher: rule, Origin: cp.origin(rulePath)})
+		}
+		ret = append(ret, category)
+	}
+	for i := range cc.Categories {
+		ret = append(ret, cp.categories(prefix, kind, name, fmt.Sprintf("%s.categories[%d]", path, i), &cc.Categories[i], names)...)
+	}
+	return ret
+}
+
+// childrenFirst moves each category in front of its ancestors, keeping the order otherwise.
+// Rules are checked in order, so that the rules of a parent category only catch events
+// which belong to none of its children, however broadly they match.
+func childrenFirst(categories []*core.Category) []*core.Category {
+	var ret []*core.Category
+	for _, c := range categories {
+		i := slices.IndexFunc(ret, func(r *core.Category) bool { return c.Name != r.Name && c.Name.Within(r.Name) })
+		if i < 0 {
+			i = len(ret)
+		}
+		ret = slices.Insert(ret, i, c)
+	}
+	return ret
+}
+
+// allDay compiles the all_day rule, which must count time in one of the given categories.
+func (cp *compiler) allDay(ac *allDayConfig, categories []*core.Category) *core.AllDayRule {
+	const path = "$.all_day"
+	rule := &core.AllDayRule{Category: core.CategoryName(ac.Category), Origin: cp.origin(path)}
+	if ac.Duration == "" {
+		cp.problem(errorAt(path, "all_day: duration is required"))
+	} else if d, err := time.ParseDuration(ac.Duration); err != nil {
+		cp.problem(errorAt(path+".duration", "all_day: invalid duration: %w", err))
+	} else if d <= 0 {
+		cp.problem(errorAt(path+".duration", "all_day: duration must be positive"))
+	} else {
+		rule.Duration = d
+	}
+	if ac.Category == "" {
+		cp.problem(errorAt(path, "all_day: category is required"))
+	} else if !slices.ContainsFunc(categories, func(c *core.Category) bool { return c.Name == rule.Category }) {
+		cp.problem(errorAt(path+".category", "all_day: unknown category %q", ac.Category))
+	}
+	var matchers core.AnyOf
+	for i, mc := range ac.Match {
+		m, err := mc.toMatcher(fmt.Sprintf("%s.match[%d]", path, i), cp.inlineTags)
+		if err != nil {
+			cp.problem(fmt.Errorf("all_day: match rule %d: %w", i+1, err))
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	if len(matchers) > 0 {
+		rule.Matcher = matchers
+	}
+	return rule
+}
+
+// parseWeekday parses the English name of a day of the week, or its first three letters, ignoring case.
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := strings.ToLower(d.String())
+		if name == full || name == full[:3] {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// toMatcher compiles the rule found at the given YAMLPath. Tag conditions are checked against the inlineTags field.
+func (mc *matchConfig) toMatcher(path string, inlineTags core.Field) (core.Matcher, error) {
+	var all core.AllOf
+	for _, c := range []struct {
+		key, field, re string
+		negate         bool
+	}{
+		{"re", "summary", mc.Regex, false},
+		{"not_re", "summary", mc.NotRegex, true},
+		{"summary", "summary", mc.Summary, false},
+		{"description", "description", mc.Description, false},
+		{"location", "location", mc.Location, false},
+		{"organizer", "organizer", mc.Organizer, false},
+		{"attendee", "attendee", mc.Attendee, false},
+	} {
+		if c.re == "" {
+			continue
+		}
+		re, err := regexp.Compile(c.re)
+		if err != nil {
+			return nil, errorAt(path+"."+c.key, "invalid %s regular expression: %w", c.key, err)
+		}
+		if neverMatches(re) {
+			return nil, errorAt(path+"."+c.key, "%s regular expression %q can never match", c.key, c.re)
+		}
+		var m core.Matcher = &core.RegexpMatcher{Field: core.Fields[c.field], Pattern: re}
+		if c.negate {
+			m = core.Not{Matcher: m}
+		}
+		all = append(all, m)
+	}
+	for _, c := range []struct{ field, value string }{
+		{"color", mc.Color},
+		{"type", mc.Type},
+		{"calendar", mc.Calendar},
+		{"organizer_domain", mc.OrganizerDomain},
+		{"attendee_domain", mc.AttendeeDomain},
+	} {
+		if c.value != "" {
+			all = append(all, &core.ValueMatcher{Field: core.Fields[c.field], Value: c.value})
+		}
+	}
+	if mc.Tag != "" {
+		all = append(all, &core.ValueMatcher{Field: inlineTags, Value: strings.TrimLeft(mc.Tag, "#")})
+	}
+	if mc.LongerThan != "" || mc.ShorterThan != "" {
+		m := &core.DurationMatcher{}
+		for _, c := range []struct {
+			key, value string
+			d          *time.Duration
+		}{
+			{"longer_than", mc.LongerThan, &m.LongerThan},
+			{"shorter_than", mc.ShorterThan, &m.ShorterThan},
+		} {
+			if c.value == "" {
+				continue
+			}
+			d, err := time.ParseDuration(c.value)
+			if err != nil {
+				return nil, errorAt(path+"."+c.key, "invalid %s: %w", c.key, err)
+			}
+			if d < 0 {
+				return nil, errorAt(path+"."+c.key, "%s must not be negative", c.key)
+			}
+			*c.d = d
+		}
+		if mc.ShorterThan != "" && m.ShorterThan <= m.LongerThan {
+			return nil, errorAt(path+".shorter_than", "shorter_than must be longer than longer_than, or no event can match")
+		}
+		all = append(all, m)
+	}
+	for _, c := range []struct {
+		key   string
+		rules []matchConfig
+	}{
+		{"all", mc.All},
+		{"any", mc.Any},
+	} {
+		if c.rules == nil {
+			continue
+		}
+		if len(c.rules) == 0 {
+			return nil, errorAt(path+"."+c.key, "%s needs at least one rule", c.key)
+		}
+		var nested []core.Matcher
+		for i, rule := range c.rules {
+			m, err := rule.toMatcher(fmt.Sprintf("%s.%s[%d]", path, c.key, i), inlineTags)
+			if err != nil {
+				return nil, fmt.Errorf("%s rule %d: %w", c.key, i+1, err)
+			}
+			nested = append(nested, m)
+		}
+		if c.key == "all" {
+			all = append(all, core.AllOf(nested))
+		} else {
+			all = append(all, core.AnyOf(nested))
+		}
+	}
+	if mc.Not != nil {
+		m, err := mc.Not.toMatcher(path+".not", inlineTags)
+		if err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+		all = append(all, core.Not{Matcher: m})
+	}
+	switch len(all) {
+	case 0:
+		return nil, errorAt(path, "no conditions")
+	case 1:
+		return all[0], nil
+	default:
+		return all, nil
+	}
+}
+
+func (sc *stretchConfig) toRule() (core.StretchRule, error) {
+	rule := core.StretchRule{
+		Category: core.CategoryName(sc.Category),
+		Calendar: sc.Calendar,
+	}
+	var err error
+	if sc.Duration != "" {
+		if sc.Min != "" || sc.Max != "" {
+			return rule, fmt.Errorf("duration cannot be combined with min or max")
+		}
+		sc.Min, sc.Max = sc.Duration, sc.Duration
+	}
+	if sc.Min == "" && sc.Max == "" {
+		return rule, fmt.Errorf("one of duration, min or max is required")
+	}
+	if sc.Min != "" {
+		if rule.Min, err = time.ParseDuration(sc.Min); err != nil {
+			return rule, fmt.Errorf("invalid min: %w", err)
+		}
+	}
+	rule.Max = time.Duration(1<<63 - 1)
+	if sc.Max != "" {
+		if rule.Max, err = time.ParseDuration(sc.Max); err != nil {
+			return rule, fmt.Errorf("invalid max: %w", err)
+		}
+	}
+	if rule.Min > rule.Max {
+		return rule, fmt.Errorf("min is greater than max")
+	}
+	if rule.To, err = time.ParseDuration(sc.To); err != nil {
+		return rule, fmt.Errorf("invalid to: %w", err)
+	}
+	if rule.To <= 0 {
+		return rule, fmt.Errorf("to must be positive")
+	}
+	// Rules only lengthen events, so one which could only shorten them would never apply.
+	if rule.To < rule.Min {
+		return rule, fmt.Errorf("to is shorter than min")
+	}
+	return rule, nil
+}
@@ -0,0 +1,590 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/porridge/calendar-stats/internal/core"
+	"github.com/porridge/calendar-stats/internal/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/calendar/v3"
+)
+
+func writeConfig(t *testing.T, text string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(fileName, []byte(text), 0600))
+	return fileName
+}
+
+func TestReadStretch(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []core.StretchRule
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			text: "categories: []\n",
+			want: core.DefaultStretchRules,
+		},
+		{
+			name: "disabled",
+			text: "stretch: []\n",
+			want: []core.StretchRule{},
+		},
+		{
+			name: "rules",
+			text: `
+categories:
+- name: meetings/external
+  match:
+  - re: call
+stretch:
+- duration: 45m
+  to: 1h
+- min: 15m
+  max: 20m
+  to: 30m
+  category: meetings
+  calendar: primary
+- min: 2h
+  to: 3h
+`,
+			want: []core.StretchRule{
+				{Min: 45 * time.Minute, Max: 45 * time.Minute, To: time.Hour},
+				{Min: 15 * time.Minute, Max: 20 * time.Minute, To: 30 * time.Minute, Category: "meetings", Calendar: "primary"},
+				{Min: 2 * time.Hour, Max: time.Duration(1<<63 - 1), To: 3 * time.Hour},
+			},
+		},
+		{
+			name:    "unknown category",
+			text:    "categories:\n- name: meetings\nstretch:\n- duration: 45m\n  to: 1h\n  category: meeting\n",
+			wantErr: `config.yaml:6:13: stretch rule 1: unknown category "meeting"`,
+		},
+		{
+			name:    "missing duration",
+			text:    "stretch:\n- to: 1h\n",
+			wantErr: "stretch rule 1: one of duration, min or max is required",
+		},
+		{
+			name:    "negative to",
+			text:    "stretch:\n- duration: 50m\n  to: -1h\n",
+			wantErr: "config.yaml:2:3: stretch rule 1: to must be positive",
+		},
+		{
+			name:    "zero to",
+			text:    "stretch:\n- max: 50m\n  to: 0s\n",
+			wantErr: "stretch rule 1: to must be positive",
+		},
+		{
+			name:    "to shorter than min",
+			text:    "stretch:\n- min: 50m\n  max: 1h\n  to: 45m\n",
+			wantErr: "stretch rule 1: to is shorter than min",
+		},
+		{
+			name:    "bad duration",
+			text:    "stretch:\n- duration: 45m\n  to: 1h\n- duration: 1 hour\n  to: 2h\n",
+			wantErr: "stretch rule 2: invalid min",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(writeConfig(t, tt.text))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Stretch)
+		})
+	}
+}
+
+func TestReadCategories(t *testing.T) {
+	cfg, err := Read(writeConfig(t, `
+categories:
+- name: customers
+  match:
+  - attendee_domain: customer.com
+    calendar: work
+  - re: "^customer:"
+- name: travel
+  match:
+  - location: "Airport"
+  - color: "5"
+`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Categories, 2)
+	customers, travel := cfg.Categories[0], cfg.Categories[1]
+
+	event := func(summary, location, color, calendarName string, attendees ...string) *calendar.Event {
+		e := &calendar.Event{Summary: summary, Location: location, ColorId: color}
+		for _, a := range attendees {
+			e.Attendees = append(e.Attendees, &calendar.EventAttendee{Email: a})
+		}
+		source.SetCalendar(e, calendarName)
+		return e
+	}
+	tests := []struct {
+		name     string
+		category *core.Category
+		event    *calendar.Event
+		want     bool
+	}{
+		{"both conditions", customers, event("sync", "", "", "work", "a@customer.com"), true},
+		{"only one condition", customers, event("sync", "", "", "personal", "a@customer.com"), false},
+		{"second rule", customers, event("customer: call", "", "", "personal"), true},
+		{"location", travel, event("flight", "Airport WAW", "", ""), true},
+		{"color", travel, event("train", "", "5", ""), true},
+		{"neither", travel, event("train", "", "6", ""), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matches(tt.category, tt.event))
+		})
+	}
+}
+
+func matches(category *core.Category, event *calendar.Event) bool {
+	for _, rule := range category.Rules {
+		if rule.Matches(event) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReadRuleExpressions(t *testing.T) {
+	cfg, err := Read(writeConfig(t, `
+categories:
+- name: reviews
+  match:
+  - re: "review"
+    not_re: "code review lunch"
+- name: workshops
+  match:
+  - longer_than: 2h
+    any:
+    - re: "workshop"
+    - location: "Lab"
+    not:
+      calendar: personal
+`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Categories, 2)
+	reviews, workshops := cfg.Categories[0], cfg.Categories[1]
+
+	event := func(summary, location, calendarName string, d time.Duration) *calendar.Event {
+		start := time.Date(2023, 3, 27, 9, 0, 0, 0, time.UTC)
+		e := &calendar.Event{
+			Summary:  summary,
+			Location: location,
+			Start:    &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+			End:      &calendar.EventDateTime{DateTime: start.Add(d).Format(time.RFC3339)},
+		}
+		source.SetCalendar(e, calendarName)
+		return e
+	}
+	tests := []struct {
+		name     string
+		category *core.Category
+		event    *calendar.Event
+		want     bool
+	}{
+		{"review", reviews, event("design review", "", "", time.Hour), true},
+		{"negated regexp", reviews, event("code review lunch", "", "", time.Hour), false},
+		{"long workshop", workshops, event("workshop", "", "work", 3*time.Hour), true},
+		{"long in lab", workshops, event("hacking", "Lab 2", "work", 3*time.Hour), true},
+		{"short workshop", workshops, event("workshop", "", "work", 2*time.Hour), false},
+		{"neither", workshops, event("hacking", "home", "work", 3*time.Hour), false},
+		{"excluded calendar", workshops, event("workshop", "", "personal", 3*time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matches(tt.category, tt.event))
+		})
+	}
+}
+
+func TestReadCategoriesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{
+			name:    "no conditions",
+			text:    "categories:\n- name: a\n  match:\n  - {}\n",
+			wantErr: `config.yaml:4:5: category "a": match rule 1: no conditions`,
+		},
+		{
+			name:    "bad regexp",
+			text:    "categories:\n- name: a\n  match:\n  - re: x\n  - location: \"(\"\n",
+			wantErr: `config.yaml:5:15: category "a": match rule 2: invalid location regular expression`,
+		},
+		{
+			name: "nested",
+			text: `categories:
+- name: a
+  match:
+  - re: x
+- name: b
+  match:
+  - any:
+    - re: y
+    - not:
+        longer_than: 2 hours
+`,
+			wantErr: `config.yaml:10:22: category "b": match rule 1: any rule 2: not: invalid longer_than`,
+		},
+		{
+			name:    "negative duration",
+			text:    "categories:\n- name: a\n  match:\n  - longer_than: -1h\n",
+			wantErr: `config.yaml:4:18: category "a": match rule 1: longer_than must not be negative`,
+		},
+		{
+			name:    "zero shorter_than",
+			text:    "categories:\n- name: a\n  match:\n  - shorter_than: 0s\n",
+			wantErr: `config.yaml:4:19: category "a": match rule 1: shorter_than must be longer than longer_than, or no event can match`,
+		},
+		{
+			name:    "empty duration range",
+			text:    "categories:\n- name: a\n  match:\n  - longer_than: 2h\n    shorter_than: 1h\n",
+			wantErr: `config.yaml:5:19: category "a": match rule 1: shorter_than must be longer than longer_than, or no event can match`,
+		},
+		{
+			name:    "empty all",
+			text:    "categories:\n- name: a\n  match:\n  - all: []\n",
+			wantErr: `config.yaml:4:10: category "a": match rule 1: all needs at least one rule`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(writeConfig(t, tt.text))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestReadNestedCategories(t *testing.T) {
+	cfg, err := Read(writeConfig(t, `
+categories:
+- name: engineering
+  categories:
+  - name: reviews
+    match:
+    - re: review
+  - name: oncall
+    match:
+    - re: page
+- name: mail
+- name: engineering/meetings
+  match:
+  - re: standup
+`))
+	require.NoError(t, err)
+	var names []core.CategoryName
+	for _, c := range cfg.Categories {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []core.CategoryName{"engineering/reviews", "engineering/oncall", "mail", "engineering/meetings"}, names)
+}
+
+func TestReadParentRulesAfterChildren(t *testing.T) {
+	cfg, err := Read(writeConfig(t, `
+categories:
+- name: engineering
+  match:
+  - re: .
+  categories:
+  - name: reviews
+    match:
+    - re: review
+- name: mail
+  match:
+  - re: mail
+- name: engineering/meetings
+  match:
+  - re: standup
+`))
+	require.NoError(t, err)
+	var names []core.CategoryName
+	for _, c := range cfg.Categories {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []core.CategoryName{"engineering/reviews", "engineering/meetings", "engineering", "mail"}, names)
+
+	event := func(summary, start, end string) *calendar.Event {
+		return &calendar.Event{
+			Summary:   summary,
+			Start:     &calendar.EventDateTime{DateTime: start},
+			End:       &calendar.EventDateTime{DateTime: end},
+			Attendees: []*calendar.EventAttendee{{Self: true, ResponseStatus: "accepted"}},
+		}
+	}
+	_, totals, _ := core.ComputeTotals([]*calendar.Event{
+		event("code review", "2023-03-27T09:00:00Z", "2023-03-27T10:00:00Z"),
+		event("standup", "2023-03-27T10:00:00Z", "2023-03-27T10:15:00Z"),
+		event("design", "2023-03-27T11:00:00Z", "2023-03-27T11:30:00Z"),
+	}, cfg.Categories, time.UTC)
+	assert.Equal(t, map[core.CategoryName]time.Duration{
+		"engineering/reviews":  time.Hour,
+		"engineering/meetings": 15 * time.Minute,
+		"engineering":          30 * time.Minute,
+	}, totals)
+}
+
+func TestReadDimensions(t *testing.T) {
+	cfg, err := Read(writeConfig(t, `
+dimensions:
+- name: project
+  tags:
+  - name: acme
+    match:
+    - attendee_domain: acme.com
+  - name: internal
+    match:
+    - re: "^internal:"
+- name: billable
+  tags:
+  - name: "yes"
+    match:
+    - color: "2"
+`))
+	require.NoError(t, err)
+	require.Len(t, cfg.Dimensions, 2)
+	assert.Equal(t, "project", cfg.Dimensions[0].Name)
+	require.Len(t, cfg.Dimensions[0].Tags, 2)
+	assert.Equal(t, core.CategoryName("internal"), cfg.Dimensions[0].Tags[1].Name)
+	assert.True(t, matches(cfg.Dimensions[1].Tags[0], &calendar.Event{ColorId: "2"}))
+
+	_, err = Read(writeConfig(t, "dimensions:\n- name: project\n  tags:\n  - name: acme\n    match:\n    - {}\n"))
+	assert.ErrorContains(t, err, `config.yaml:6:7: dimension "project": tag "acme": match rule 1: no conditions`)
+}
+
+func TestReadTagCondition(t *testing.T) {
+	cfg, err := Read(writeConfig(t, `
+inline_tags:
+  descriptions: true
+categories:
+- name: billable
+  match:
+  - tag: "#billable"
+`))
+	require.NoError(t, err)
+	assert.True(t, cfg.DescriptionTags)
+	billable := cfg.Categories[0]
+	assert.True(t, matches(billable, &calendar.Event{Summary: "sync #Billable"}))
+	assert.True(t, matches(billable, &calendar.Event{Summary: "sync", Description: "#billable"}))
+	assert.False(t, matches(billable, &calendar.Event{Summary: "billable"}))
+}
+
+func TestReadReportsAllProblems(t *testing.T) {
+	_, err := Read(writeConfig(t, `categories:
+- name: mail
+  match:
+  - re: "mail"
+- name: ""
+  match:
+  - re: "x"
+- name: mail
+  match:
+  - re: "mail$ now"
+- name: reviews
+  match:
+  - re: "[z-a]"
+stretch:
+- to: 1h
+`))
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		`config.yaml:5:3: category has no name`,
+		`config.yaml:8:9: duplicate category "mail"`,
+		`config.yaml:10:9: category "mail": match rule 1: re regular expression "mail$ now" can never match`,
+		`config.yaml:13:9: category "reviews": match rule 1: invalid re regular expression: error parsing regexp: invalid character class range: ` + "`z-a`",
+		`config.yaml:15:3: stretch rule 1: one of duration, min or max is required`,
+	}, problems(err))
+}
+
+func TestReadUnknownField(t *testing.T) {
+	_, err := Read(writeConfig(t, "categories:\n- name: mail\n  match:\n  - regex: mail\n"))
+	require.Error(t, err)
+	assert.Equal(t, []string{`config.yaml:4:5: unknown field "regex"`}, problems(err))
+}
+
+// problems returns error messages, one per line, without the directory of the config file.
+func problems(err error) []string {
+	var ret []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		ret = append(ret, filepath.Base(line))
+	}
+	return ret
+}
+
+func TestNeverMatches(t *testing.T) {
+	tests := []struct {
+		re   string
+		want bool
+	}{
+		{"mail", false},
+		{"^mail$", false},
+		{"(?m)mail$\n^review", false},
+		{"^$", false},
+		{"a^b", true},
+		{"mail$ now", true},
+		{`mail\z.`, true},
+		{"(^|x)review", false},
+		{"x(^)review", true},
+		{"a?^b", false},
+		{"[^\\x00-\\x{10FFFF}]", true},
+		{"mail|a^b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.re, func(t *testing.T) {
+			assert.Equal(t, tt.want, neverMatches(regexp.MustCompile(tt.re)))
+		})
+	}
+}
+
+func TestReadInclude(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want core.Policy
+	}{
+		{
+			name: "defaults",
+			text: "categories: []\n",
+			want: core.Policy{},
+		},
+		{
+			name: "everything",
+			text: `
+include:
+  tentative: true
+  unanswered: true
+  focus_time: false
+  transparent: false
+  out_of_office: true
+  working_location: true
+`,
+			want: core.Policy{Tentative: true, Unanswered: true, SkipFocusTime: true, SkipTransparent: true, OutOfOffice: true, WorkingLocation: true},
+		},
+		{
+			name: "explicit defaults",
+			text: "include:\n  tentative: false\n  focus_time: true\n",
+			want: core.Policy{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Read(writeConfig(t, tt.text))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.Policy)
+		})
+	}
+}
+
+func TestReadAllDay(t *testing.T) {
+	cfg, err := Read(writeConfig(t, `categories:
+- name: leave
+working_days: [Sunday, mon, tue, wed, thu]
+all_day:
+  duration: 8h
+  category: leave
+  match:
+  - type: outOfOffice
+  - re: vacation
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday}, cfg.WorkingDays)
+	require.NotNil(t, cfg.AllDay)
+	assert.Equal(t, 8*time.Hour, cfg.AllDay.Duration)
+	assert.Equal(t, core.CategoryName("leave"), cfg.AllDay.Category)
+	assert.True(t, cfg.AllDay.Matcher.Matches(&calendar.Event{EventType: "outOfOffice"}))
+	assert.True(t, cfg.AllDay.Matcher.Matches(&calendar.Event{Summary: "vacation"}))
+	assert.False(t, cfg.AllDay.Matcher.Matches(&calendar.Event{Summary: "birthday"}))
+
+	_, err = Read(writeConfig(t, `categories:
+- name: leave
+working_days: [monday, someday]
+all_day:
+  duration: -8h
+  category: holidays
+`))
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		`config.yaml:3:24: unknown day of the week "someday"`,
+		`config.yaml:5:13: all_day: duration must be positive`,
+		`config.yaml:6:13: all_day: unknown category "holidays"`,
+	}, problems(err))
+}
+
+func TestReadWorkingHours(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "holidays.txt"), []byte("# Poland\n\n2023-05-01 Labour Day\n2023-05-03\n"), 0600))
+	fileName := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(fileName, []byte(`working_hours:
+  time_zone: Europe/Warsaw
+  holidays: holidays.txt
+  monday: 09:00-17:00
+  friday: "09:00-12:00, 13:00-15:30"
+`), 0600))
+	cfg, err := Read(fileName)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Schedule)
+	assert.Equal(t, "Europe/Warsaw", cfg.Schedule.Location.String())
+	assert.Equal(t, map[time.Weekday][]core.TimeRange{
+		time.Monday: {{Start: civil.Time{Hour: 9}, End: civil.Time{Hour: 17}}},
+		time.Friday: {
+			{Start: civil.Time{Hour: 9}, End: civil.Time{Hour: 12}},
+			{Start: civil.Time{Hour: 13}, End: civil.Time{Hour: 15, Minute: 30}},
+		},
+	}, cfg.Schedule.Hours)
+	assert.Equal(t, map[civil.Date]string{
+		{Year: 2023, Month: 5, Day: 1}: "Labour Day",
+		{Year: 2023, Month: 5, Day: 3}: "",
+	}, cfg.Schedule.Holidays)
+
+	_, err = Read(writeConfig(t, `working_days: [mon]
+working_hours:
+  time_zone: Mars
+  monday: 17:00-09:00
+  tuesday: 9-17
+`))
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		`config.yaml:1:15: working_days cannot be used together with working_hours, which tells the working days too`,
+		`config.yaml:3:14: working_hours: unknown time zone "Mars"`,
+		`config.yaml:4:11: working_hours: monday: range "17:00-09:00" ends before it starts`,
+		`config.yaml:5:12: working_hours: tuesday: invalid time "9", want one such as 09:00`,
+	}, problems(err))
+}
+
+func TestReadSwitching(t *testing.T) {
+	cfg, err := Read(writeConfig(t, `switching:
+  max_switches: 10
+  min_average_stretch: 20m
+  max_fragmentation: 2.5
+`))
+	require.NoError(t, err)
+	assert.Equal(t, core.SwitchingThresholds{MaxSwitches: 10, MinAverageStretch: 20 * time.Minute, MaxFragmentation: 2.5}, cfg.Switching)
+
+	_, err = Read(writeConfig(t, "switching:\n  min_average_stretch: long\n"))
+	require.Error(t, err)
+	assert.Equal(t, []string{`config.yaml:2:24: switching: invalid min_average_stretch: time: invalid duration "long"`}, problems(err))
+}
+
+func TestReadMeetings(t *testing.T) {
+	cfg, err := Read(writeConfig(t, "meetings:\n  internal_domains: [example.com, example.org]\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "example.org"}, cfg.InternalDomains)
+}
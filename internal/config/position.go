@@ -0,0 +1,80 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// pathError is an error in the part of the configuration file found at path,
+// a YAMLPath such as "$.categories[0].match[1]".
+type pathError struct {
+	path string
+	err  error
+}
+
+func (e *pathError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pathError) Unwrap() error {
+	return e.err
+}
+
+func errorAt(path string, format string, a ...any) error {
+	return &pathError{path: path, err: fmt.Errorf(format, a...)}
+}
+
+// locate prefixes err with the file name, and the line and column of the pathError
+// or YAML decoding error in it, if any.
+func locate(fileName string, data []byte, err error) error {
+	var ye yaml.Error
+	if errors.As(err, &ye) && ye.GetToken() != nil {
+		pos := ye.GetToken().Position
+		return fmt.Errorf("%s:%d:%d: %s", fileName, pos.Line, pos.Column, ye.GetMessage())
+	}
+	var pe *pathError
+	if !errors.As(err, &pe) {
+		return fmt.Errorf("%s: %w", fileName, err)
+	}
+	if line, column, ok := position(data, pe.path); ok {
+		return fmt.Errorf("%s:%d:%d: %w", fileName, line, column, err)
+	}
+	return fmt.Errorf("%s: %w", fileName, err)
+}
+
+func position(data []byte, path string) (int, int, bool) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return 0, 0, false
+	}
+	return positionIn(file, path)
+}
+
+func positionIn(file *ast.File, path string) (int, int, bool) {
+	p, err := yaml.PathString(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	node, err := p.FilterFile(file)
+	if err != nil || node == nil {
+		return 0, 0, false
+	}
+	// Point at the first key of a mapping, rather than at the colon after it.
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		if len(n.Values) > 0 && !n.IsFlowStyle {
+			node = n.Values[0].Key
+		}
+	case *ast.MappingValueNode:
+		node = n.Key
+	}
+	if node.GetToken() == nil {
+		return 0, 0, false
+	}
+	pos := node.GetToken().Position
+	return pos.Line, pos.Column, true
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"regexp"
+	"regexp/syntax"
+)
+
+// neverMatches returns true if there is no text the expression could match,
+// for example because it requires the text to begin after some other text, as in "a^b".
+// It only recognizes common mistakes, so false does not guarantee that a match is possible.
+func neverMatches(re *regexp.Regexp) bool {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return false
+	}
+	return never(parsed.Simplify())
+}
+
+func never(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return true
+	case syntax.OpCharClass:
+		return len(re.Rune) == 0
+	case syntax.OpCapture, syntax.OpPlus:
+		return never(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min > 0 && never(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !never(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpConcat:
+		for i, sub := range re.Sub {
+			if never(sub) {
+				return true
+			}
+			switch anchor(sub) {
+			case syntax.OpBeginText:
+				for _, before := range re.Sub[:i] {
+					if consumes(before) {
+						return true
+					}
+				}
+			case syntax.OpEndText:
+				for _, after := range re.Sub[i+1:] {
+					if consumes(after) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// anchor returns the operator of a text anchor, possibly within capture groups, or OpNoMatch if re is not one.
+func anchor(re *syntax.Regexp) syntax.Op {
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	if re.Op == syntax.OpBeginText || re.Op == syntax.OpEndText {
+		return re.Op
+	}
+	return syntax.OpNoMatch
+}
+
+// consumes returns true if every match of re is at least one character long.
+func consumes(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune) > 0
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpCapture, syntax.OpPlus:
+		return consumes(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min > 0 && consumes(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if consumes(sub) {
+				return true
+			}
+		}
+		return false
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !consumes(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/porridge/calendar-stats/internal/core"
+)
+
+// workingHoursConfig is a weekly schedule. Working hours on each day are written as
+// comma-separated ranges, such as "09:00-17:00" or "09:00-12:00, 13:00-17:00".
+type workingHoursConfig struct {
+	// TimeZone is the name of the time zone of the working hours, the local one if empty.
+	TimeZone string `yaml:"time_zone"`
+	// Holidays is the name of a file listing dates on which no work is expected,
+	// relative to the directory of the configuration file.
+	Holidays  string `yaml:"holidays"`
+	Monday    string `yaml:"monday"`
+	Tuesday   string `yaml:"tuesday"`
+	Wednesday string `yaml:"wednesday"`
+	Thursday  string `yaml:"thursday"`
+	Friday    string `yaml:"friday"`
+	Saturday  string `yaml:"saturday"`
+	Sunday    string `yaml:"sunday"`
+}
+
+// schedule compiles the working hours found at the given YAMLPath.
+func (cp *compiler) schedule(path string, wc *workingHoursConfig) *core.Schedule {
+	s := &core.Schedule{Location: time.Local, Hours: make(map[time.Weekday][]core.TimeRange)}
+	if wc.TimeZone != "" {
+		location, err := time.LoadLocation(wc.TimeZone)
+		if err != nil {
+			cp.problem(errorAt(path+".time_zone", "working_hours: unknown time zone %q", wc.TimeZone))
+		} else {
+			s.Location = location
+		}
+	}
+	configured := false
+	for _, d := range []struct {
+		day   time.Weekday
+		hours string
+	}{
+		{time.Monday, wc.Monday},
+		{time.Tuesday, wc.Tuesday},
+		{time.Wednesday, wc.Wednesday},
+		{time.Thursday, wc.Thursday},
+		{time.Friday, wc.Friday},
+		{time.Saturday, wc.Saturday},
+		{time.Sunday, wc.Sunday},
+	} {
+		if d.hours == "" {
+			continue
+		}
+		configured = true
+		key := strings.ToLower(d.day.String())
+		hours, err := parseHours(d.hours)
+		if err != nil {
+			cp.problem(errorAt(path+"."+key, "working_hours: %s: %w", key, err))
+			continue
+		}
+		s.Hours[d.day] = hours
+	}
+	if !configured {
+		cp.problem(errorAt(path, "working_hours: no working hours on any day"))
+	}
+	if wc.Holidays != "" {
+		fileName := wc.Holidays
+		if !filepath.IsAbs(fileName) {
+			fileName = filepath.Join(filepath.Dir(cp.fileName), fileName)
+		}
+		holidays, err := readHolidays(fileName)
+		if err != nil {
+			cp.problem(errorAt(path+".holidays", "working_hours: %w", err))
+		}
+		s.Holidays = holidays
+	}
+	return s
+}
+
+// parseHours parses comma-separated ranges of time, such as "09:00-12:00, 13:00-17:00".
+func parseHours(text string) ([]core.TimeRange, error) {
+	var ret []core.TimeRange
+	for _, part := range strings.Split(text, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid range %q, want one such as 09:00-17:00", strings.TrimSpace(part))
+		}
+		var r core.TimeRange
+		var err error
+		if r.Start, err = parseTimeOfDay(from); err != nil {
+			return nil, err
+		}
+		if r.End, err = parseTimeOfDay(to); err != nil {
+			return nil, err
+		}
+		if !r.Start.Before(r.End) {
+			return nil, fmt.Errorf("range %q ends before it starts", strings.TrimSpace(part))
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+func parseTimeOfDay(text string) (civil.Time, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(text))
+	if err != nil {
+		return civil.Time{}, fmt.Errorf("invalid time %q, want one such as 09:00", strings.TrimSpace(text))
+	}
+	return civil.TimeOf(t), nil
+}
+
+// readHolidays reads a file with one date per line, in YYYY-MM-DD format, optionally followed by
+// the name of the holiday. Empty lines and lines starting with # are ignored.
+func readHolidays(fileName string) (map[civil.Date]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ret := make(map[civil.Date]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		date, name, _ := strings.Cut(text, " ")
+		day, err := civil.ParseDate(date)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid date %q", fileName, line, date)
+		}
+		ret[day] = strings.TrimSpace(name)
+	}
+	return ret, scanner.Err()
+}
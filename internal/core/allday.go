@@ -0,0 +1,151 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"time"
+
+	"cloud.google.com/go/civil"
+	"google.golang.org/api/calendar/v3"
+)
+
+// DefaultWorkingDays are the working days used when Options do not list any.
+var DefaultWorkingDays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+// AllDayRule makes all-day events and out of office entries, which are otherwise not counted,
+// count as a fixed amount of time on each working day they cover.
+type AllDayRule struct {
+	// Duration is the time counted per day. Less is counted on days which the event only covers partly.
+	Duration time.Duration
+	// Category is where the time is counted.
+	Category CategoryName
+	// Matcher, if not nil, limits the rule to matching events.
+	Matcher Matcher
+	// Origin describes where the rule comes from.
+	Origin string
+}
+
+// applies returns true if the event is counted by the rule rather than skipped.
+func (r *AllDayRule) applies(event *calendar.Event, policy Policy) bool {
+	if r == nil {
+		return false
+	}
+	switch policy.exclusionReason(event) {
+	case AllDay, OutOfOffice:
+	default:
+		return false
+	}
+	if policy.attendance(event) != "" {
+		return false
+	}
+	return r.Matcher == nil || r.Matcher.Matches(event)
+}
+
+// days returns the time to count on each working day covered by the event, within the time range.
+func (r *AllDayRule) days(event *calendar.Event, opts Options) map[civil.Date]time.Duration {
+	evStart, evEnd, ok := eventDays(event, opts.Location)
+	if !ok {
+		return nil
+	}
+	evStart, evEnd, isInside := clip(evStart, evEnd, opts.Start, opts.End)
+	if !isInside {
+		return nil
+	}
+	ret := make(map[civil.Date]time.Duration)
+	for day := civil.DateOf(evStart); day.In(opts.Location).Before(evEnd); day = day.AddDays(1) {
+		if !opts.isWorkingDay(day) {
+			continue
+		}
+		start, end, isInside := clip(evStart, evEnd, day.In(opts.Location), day.AddDays(1).In(opts.Location))
+		if !isInside {
+			continue
+		}
+		ret[day] = min(end.Sub(start), r.Duration)
+	}
+	return ret
+}
+
+// eventDays returns the time covered by the event, with days of all-day events beginning at midnight in the given location.
+func eventDays(event *calendar.Event, location *time.Location) (time.Time, time.Time, bool) {
+	if event.Start == nil || event.End == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	if event.Start.DateTime != "" {
+		evStart, err1 := time.Parse(time.RFC3339, event.Start.DateTime)
+		evEnd, err2 := time.Parse(time.RFC3339, event.End.DateTime)
+		return evStart.In(location), evEnd.In(location), err1 == nil && err2 == nil
+	}
+	startDay, err1 := civil.ParseDate(event.Start.Date)
+	endDay, err2 := civil.ParseDate(event.End.Date)
+	return startDay.In(location), endDay.In(location), err1 == nil && err2 == nil
+}
+
+func (o Options) isWorkingDay(day civil.Date) bool {
+	if o.Schedule != nil {
+		return len(o.Schedule.hours(day)) > 0
+	}
+	workingDays := o.WorkingDays
+	if len(workingDays) == 0 {
+		workingDays = DefaultWorkingDays
+	}
+	weekday := day.In(time.UTC).Weekday()
+	for _, d := range workingDays {
+		if d == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// countAllDay adds time counted by the all-day rule to the totals,
+// and returns the time covered by the events it counted, within the time range.
+func countAllDay(totals *Totals, events []*calendar.Event, opts Options) []Block {
+	if opts.AllDay == nil {
+		return nil
+	}
+	var covered []Block
+	inlineTags := InlineTagsField(opts.DescriptionTags)
+	for _, event := range events {
+		if !opts.AllDay.applies(event, opts.Policy) {
+			continue
+		}
+		category := opts.AllDay.Category
+		meeting := newMeeting(event, opts.InternalDomains)
+		days := opts.AllDay.days(event, opts)
+		if len(days) > 0 {
+			evStart, evEnd, _ := eventDays(event, opts.Location)
+			evStart, evEnd, _ = clip(evStart, evEnd, opts.Start, opts.End)
+			covered = append(covered, Block{Start: evStart, End: evEnd})
+		}
+		for day, amount := range days {
+			totals.Days[day] += amount
+			totals.Categories[category] += amount
+			if totals.DayCategories[day] == nil {
+				totals.DayCategories[day] = make(map[CategoryName]time.Duration)
+			}
+			totals.DayCategories[day][category] += amount
+			totals.WithinHours[day] += amount
+			totals.Meetings.add(meeting, amount)
+			for _, d := range opts.Dimensions {
+				totals.Dimensions[d.Name][d.tag(event)] += amount
+			}
+			for _, tag := range inlineTags(event) {
+				totals.Tags[tag] += amount
+			}
+		}
+	}
+	return covered
+}
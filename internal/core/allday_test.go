@@ -0,0 +1,101 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func newAllDayEvent(startDate, endDate, title string) *calendar.Event {
+	return &calendar.Event{
+		Organizer: &calendar.EventOrganizer{Self: true},
+		Start:     &calendar.EventDateTime{Date: startDate},
+		End:       &calendar.EventDateTime{Date: endDate},
+		Summary:   title,
+	}
+}
+
+func TestComputeAllDay(t *testing.T) {
+	vacation := newAllDayEvent("2023-03-24", "2023-03-28", "vacation") // Friday to Monday
+	dentist := newEvent("2023-03-28T13:00:00Z", "2023-03-28T17:00:00Z", "dentist")
+	dentist.EventType = "outOfOffice"
+	declined := newAllDayEvent("2023-03-29", "2023-03-30", "offsite")
+	declined.Organizer.Self = false
+	declined.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: "declined"}}
+	events := []*calendar.Event{
+		vacation,
+		dentist,
+		declined,
+		newAllDayEvent("2023-03-30", "2023-03-31", "birthday"),
+		newEvent("2023-03-28T09:00:00Z", "2023-03-28T10:00:00Z", "sync"),
+	}
+	categories := []*Category{
+		{Name: "meetings", Patterns: []*regexp.Regexp{regexp.MustCompile("sync")}},
+		{Name: "leave"},
+	}
+	opts := Options{
+		Location: time.UTC,
+		AllDay: &AllDayRule{
+			Duration: 8 * time.Hour,
+			Category: "leave",
+			Matcher:  Not{&RegexpMatcher{Field: Fields["summary"], Pattern: regexp.MustCompile("birthday")}},
+		},
+	}
+
+	totals := Compute(events, categories, opts)
+	assert.Equal(t, map[CategoryName]time.Duration{
+		"meetings": time.Hour,
+		"leave":    20 * time.Hour,
+	}, totals.Categories)
+	assert.Equal(t, map[civil.Date]time.Duration{
+		{Year: 2023, Month: 3, Day: 24}: 8 * time.Hour,
+		{Year: 2023, Month: 3, Day: 27}: 8 * time.Hour,
+		{Year: 2023, Month: 3, Day: 28}: 5 * time.Hour,
+	}, totals.Days)
+	assert.Empty(t, totals.Unrecognized)
+
+	t.Run("clipped to time range", func(t *testing.T) {
+		opts := opts
+		opts.Start = time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC)
+		opts.End = time.Date(2023, 3, 28, 15, 0, 0, 0, time.UTC)
+		totals := Compute(events, categories, opts)
+		assert.Equal(t, 10*time.Hour, totals.Categories["leave"])
+	})
+
+	t.Run("working days", func(t *testing.T) {
+		opts := opts
+		opts.WorkingDays = []time.Weekday{time.Sunday, time.Monday}
+		totals := Compute(events, categories, opts)
+		assert.Equal(t, 16*time.Hour, totals.Categories["leave"])
+	})
+
+	t.Run("explained", func(t *testing.T) {
+		explanations := Explain(events, categories, opts)
+		assert.Equal(t, 16*time.Hour, explanations[0].Fixed)
+		assert.Equal(t, CategoryName("leave"), explanations[0].Category)
+		assert.Equal(t, Exclusion(""), explanations[1].Excluded)
+		assert.Equal(t, 4*time.Hour, explanations[1].Fixed)
+		assert.Equal(t, AllDay, explanations[2].Excluded)
+		assert.Zero(t, explanations[2].Fixed)
+		assert.Equal(t, AllDay, explanations[3].Excluded)
+	})
+}
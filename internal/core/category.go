@@ -1,7 +1,10 @@
 package core
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	"google.golang.org/api/calendar/v3"
 )
@@ -10,16 +13,94 @@ type CategoryName string
 
 const Uncategorized = CategoryName("")
 
+// CategorySeparator separates names of parent and child categories, as in "engineering/reviews".
+const CategorySeparator = "/"
+
+// Parent returns the name of the parent category, or Uncategorized for top-level categories.
+func (n CategoryName) Parent() CategoryName {
+	i := strings.LastIndex(string(n), CategorySeparator)
+	if i < 0 {
+		return Uncategorized
+	}
+	return n[:i]
+}
+
+// Base returns the last part of the name, without names of parent categories.
+func (n CategoryName) Base() string {
+	return string(n[strings.LastIndex(string(n), CategorySeparator)+1:])
+}
+
+// Depth returns the number of ancestors of the category.
+func (n CategoryName) Depth() int {
+	return strings.Count(string(n), CategorySeparator)
+}
+
+// Within returns true if the category is the given one or its descendant.
+func (n CategoryName) Within(ancestor CategoryName) bool {
+	return n == ancestor || strings.HasPrefix(string(n), string(ancestor)+CategorySeparator)
+}
+
+// RollUp returns the time spent in each category together with its descendants,
+// for the given categories and all their ancestors.
+func RollUp(categoryTotals map[CategoryName]time.Duration) map[CategoryName]time.Duration {
+	ret := make(map[CategoryName]time.Duration)
+	for name, d := range categoryTotals {
+		ret[name] += d
+		if name == Uncategorized {
+			continue
+		}
+		for parent := name.Parent(); parent != Uncategorized; parent = parent.Parent() {
+			ret[parent] += d
+		}
+	}
+	return ret
+}
+
 type Category struct {
-	Name     CategoryName
+	Name CategoryName
+	// Patterns are matched against event summaries.
 	Patterns []*regexp.Regexp
+	// Rules are matched against whole events.
+	Rules []Matcher
+}
+
+// Rule is a Matcher which knows where it was defined.
+type Rule struct {
+	Matcher
+	// Origin describes where the rule was defined, for example a place in the configuration file.
+	Origin string
 }
 
+// recognizes returns true if any of the patterns or rules matches the event.
 func (c *Category) recognizes(event *calendar.Event) bool {
+	_, ok := c.match(event)
+	return ok
+}
+
+// match returns a description of the first pattern or rule which matches the event, if any.
+func (c *Category) match(event *calendar.Event) (string, bool) {
 	for _, pattern := range c.Patterns {
 		if pattern.MatchString(event.Summary) {
-			return true
+			return fmt.Sprintf("pattern %q", pattern), true
+		}
+	}
+	for i, rule := range c.Rules {
+		if rule.Matches(event) {
+			if r, ok := rule.(*Rule); ok && r.Origin != "" {
+				return r.Origin, true
+			}
+			return fmt.Sprintf("rule %d", i+1), true
+		}
+	}
+	return "", false
+}
+
+// categorize returns the first category which recognizes the event, or nil.
+func categorize(categories []*Category, event *calendar.Event) *Category {
+	for _, aCategory := range categories {
+		if aCategory.recognizes(event) {
+			return aCategory
 		}
 	}
-	return false
+	return nil
 }
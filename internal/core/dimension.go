@@ -0,0 +1,36 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import "google.golang.org/api/calendar/v3"
+
+// Untagged is the tag of events which get no other tag in a dimension.
+const Untagged = CategoryName("")
+
+// Dimension is a way of classifying events independent of categories, for example by project
+// or by billability. Each event gets at most one tag in each dimension: the first which recognizes it.
+type Dimension struct {
+	Name string
+	Tags []*Category
+}
+
+// tag returns the name of the first tag which recognizes the event, or Untagged.
+func (d *Dimension) tag(event *calendar.Event) CategoryName {
+	if aTag := categorize(d.Tags, event); aTag != nil {
+		return aTag.Name
+	}
+	return Untagged
+}
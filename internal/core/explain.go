@@ -0,0 +1,96 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Explanation tells what happened to an event during accounting.
+type Explanation struct {
+	Event *calendar.Event
+	// Excluded is the reason the event was not counted, or empty if it was.
+	Excluded Exclusion
+	// Start and End are the times the event is counted between, after stretching and clipping to the time range.
+	Start, End time.Time
+	// Scheduled is the duration of the event before stretching and clipping.
+	Scheduled time.Duration
+	// Fixed is the time counted for an event counted by the all-day rule, in which case
+	// Start and End only tell the part of it within the time range.
+	Fixed time.Duration
+	// Category is the category of the event, and Rule describes the pattern or rule which put it there.
+	Category CategoryName
+	Rule     string
+}
+
+// Explain tells what Compute does with each of the events, in the same order.
+func Explain(events []*calendar.Event, categories []*Category, opts Options) []Explanation {
+	var ret []Explanation
+	for _, event := range events {
+		ret = append(ret, explain(event, categories, opts))
+	}
+	return ret
+}
+
+func explain(event *calendar.Event, categories []*Category, opts Options) Explanation {
+	e := Explanation{Event: event}
+	if e.Excluded = opts.Policy.exclusionReason(event); e.Excluded != "" {
+		if opts.AllDay.applies(event, opts.Policy) {
+			explainAllDay(&e, opts)
+		}
+		return e
+	}
+	isAccepted, evStart, evEnd := parseEvent(event, opts.Policy)
+	if !isAccepted {
+		e.Excluded = InvalidTime
+		return e
+	}
+	e.Scheduled = evEnd.Sub(evStart)
+	evStart, evEnd = stretch(opts.Stretch, categories, event, evStart, evEnd)
+	evStart, evEnd, isInside := clip(evStart, evEnd, opts.Start, opts.End)
+	if !isInside {
+		e.Excluded = OutsideRange
+		return e
+	}
+	e.Start, e.End = evStart, evEnd
+	if opts.Location != nil {
+		e.Start, e.End = evStart.In(opts.Location), evEnd.In(opts.Location)
+	}
+	for _, aCategory := range categories {
+		if rule, ok := aCategory.match(event); ok {
+			e.Category, e.Rule = aCategory.Name, rule
+			break
+		}
+	}
+	return e
+}
+
+func explainAllDay(e *Explanation, opts Options) {
+	for _, amount := range opts.AllDay.days(e.Event, opts) {
+		e.Fixed += amount
+	}
+	if e.Fixed == 0 {
+		return
+	}
+	evStart, evEnd, _ := eventDays(e.Event, opts.Location)
+	e.Start, e.End, _ = clip(evStart, evEnd, opts.Start, opts.End)
+	e.Scheduled = evEnd.Sub(evStart)
+	e.Excluded = ""
+	e.Category = opts.AllDay.Category
+	e.Rule = opts.AllDay.Origin
+}
@@ -0,0 +1,88 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestExplain(t *testing.T) {
+	declined := newEvent("2023-03-27T12:00:00Z", "2023-03-27T13:00:00Z", "lunch")
+	declined.Organizer.Self = false
+	declined.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: "declined"}}
+	tentative := newEvent("2023-03-27T14:00:00Z", "2023-03-27T15:00:00Z", "maybe")
+	tentative.Organizer.Self = false
+	tentative.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: "tentative"}}
+	stranger := newEvent("2023-03-27T16:00:00Z", "2023-03-27T17:00:00Z", "someone else's")
+	stranger.Organizer.Self = false
+	allDay := &calendar.Event{Summary: "holiday", Start: &calendar.EventDateTime{Date: "2023-03-28"}, End: &calendar.EventDateTime{Date: "2023-03-29"}}
+	ooo := newEvent("2023-03-28T08:00:00Z", "2023-03-28T16:00:00Z", "away")
+	ooo.EventType = "outOfOffice"
+	location := newEvent("2023-03-28T08:00:00Z", "2023-03-28T16:00:00Z", "office")
+	location.EventType = "workingLocation"
+	events := []*calendar.Event{
+		newEvent("2023-03-27T09:00:00Z", "2023-03-27T09:25:00Z", "read mail"),
+		newEvent("2023-03-27T10:00:00Z", "2023-03-27T11:00:00Z", "mail triage"),
+		newEvent("2023-03-27T11:00:00Z", "2023-03-27T11:30:00Z", "chat"),
+		newEvent("2023-03-26T23:00:00Z", "2023-03-27T01:00:00Z", "late"),
+		newEvent("2023-03-26T10:00:00Z", "2023-03-26T11:00:00Z", "before"),
+		declined, tentative, stranger, allDay, ooo, location,
+	}
+	categories := []*Category{
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("^read")}, Rules: []Matcher{
+			&Rule{Matcher: &RegexpMatcher{Fields["summary"], regexp.MustCompile("mail")}, Origin: "config.yaml:4:5"},
+		}},
+	}
+	got := Explain(events, categories, Options{
+		Location: time.UTC,
+		Start:    time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		Stretch:  DefaultStretchRules,
+	})
+
+	type summary struct {
+		Excluded   Exclusion
+		Start, End string
+		Category   CategoryName
+		Rule       string
+	}
+	var summaries []summary
+	for _, e := range got {
+		s := summary{Excluded: e.Excluded, Category: e.Category, Rule: e.Rule}
+		if e.Excluded == "" {
+			s.Start, s.End = e.Start.Format("15:04"), e.End.Format("15:04")
+		}
+		summaries = append(summaries, s)
+	}
+	assert.Equal(t, []summary{
+		{Start: "09:00", End: "09:30", Category: "mail", Rule: `pattern "^read"`},
+		{Start: "10:00", End: "11:00", Category: "mail", Rule: "config.yaml:4:5"},
+		{Start: "11:00", End: "11:30"},
+		{Start: "00:00", End: "01:00"},
+		{Excluded: OutsideRange},
+		{Excluded: Declined},
+		{Excluded: NotAccepted},
+		{Excluded: SelfNotFound},
+		{Excluded: AllDay},
+		{Excluded: OutOfOffice},
+		{Excluded: WorkingLocation},
+	}, summaries)
+	assert.Equal(t, 25*time.Minute, got[0].Scheduled)
+}
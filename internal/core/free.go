@@ -0,0 +1,81 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// Block is an uninterrupted stretch of time.
+type Block struct {
+	Start, End time.Time
+}
+
+func (b Block) Duration() time.Duration {
+	return b.End.Sub(b.Start)
+}
+
+// findFree fills in the stretches of working time within the scheduled range, in which none of the busy blocks run.
+func findFree(totals *Totals, opts Options, busy []Block) {
+	from, to, ok := scheduledRange(totals, opts)
+	if !ok {
+		return
+	}
+	totals.Free = subtract(opts.Schedule.blocks(from, to), merge(busy))
+}
+
+// merge returns the time covered by the blocks, as blocks which do not overlap or touch, in chronological order.
+func merge(blocks []Block) []Block {
+	sorted := slices.Clone(blocks)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+	var ret []Block
+	for _, b := range sorted {
+		if last := len(ret) - 1; last >= 0 && !b.Start.After(ret[last].End) {
+			if b.End.After(ret[last].End) {
+				ret[last].End = b.End
+			}
+			continue
+		}
+		ret = append(ret, b)
+	}
+	return ret
+}
+
+// subtract returns the parts of blocks not covered by any of the busy ones.
+// Both need to be in chronological order and may not overlap, busy ones as returned by merge.
+func subtract(blocks, busy []Block) []Block {
+	ret := []Block{}
+	for _, b := range blocks {
+		start := b.Start
+		// Skip busy blocks which end before this one, they also end before any later one.
+		skip := sort.Search(len(busy), func(i int) bool { return busy[i].End.After(start) })
+		for _, x := range busy[skip:] {
+			if !x.Start.Before(b.End) {
+				break
+			}
+			if x.Start.After(start) {
+				ret = append(ret, Block{Start: start, End: x.Start})
+			}
+			start = x.End
+		}
+		if start.Before(b.End) {
+			ret = append(ret, Block{Start: start, End: b.End})
+		}
+	}
+	return ret
+}
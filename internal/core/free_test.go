@@ -0,0 +1,73 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestComputeFree(t *testing.T) {
+	hours := []TimeRange{
+		{Start: civil.Time{Hour: 9}, End: civil.Time{Hour: 12}},
+		{Start: civil.Time{Hour: 13}, End: civil.Time{Hour: 17}},
+	}
+	dentist := newEvent("2023-03-27T16:00:00Z", "2023-03-27T18:00:00Z", "dentist")
+	dentist.EventType = "outOfOffice"
+	events := []*calendar.Event{
+		newEvent("2023-03-27T09:30:00Z", "2023-03-27T10:00:00Z"),
+		newEvent("2023-03-27T09:45:00Z", "2023-03-27T10:30:00Z"),
+		newEvent("2023-03-27T11:00:00Z", "2023-03-27T11:15:00Z"),
+		newEvent("2023-03-27T12:30:00Z", "2023-03-27T14:00:00Z"),
+		dentist,
+	}
+	totals := Compute(events, []*Category{{Name: "leave"}}, Options{
+		Location: time.UTC,
+		Start:    time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 3, 29, 0, 0, 0, 0, time.UTC),
+		Schedule: &Schedule{Location: time.UTC, Hours: map[time.Weekday][]TimeRange{time.Monday: hours, time.Tuesday: hours[:1]}},
+		AllDay:   &AllDayRule{Duration: 8 * time.Hour, Category: "leave"},
+	})
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2023, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+	assert.Equal(t, []Block{
+		{Start: at(27, 9, 0), End: at(27, 9, 30)},
+		{Start: at(27, 10, 30), End: at(27, 11, 0)},
+		{Start: at(27, 11, 15), End: at(27, 12, 0)},
+		{Start: at(27, 14, 0), End: at(27, 16, 0)},
+		{Start: at(28, 9, 0), End: at(28, 12, 0)},
+	}, totals.Free)
+}
+
+func TestMerge(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2023, 3, 27, hour, 0, 0, 0, time.UTC)
+	}
+	assert.Equal(t, []Block{
+		{Start: at(8), End: at(12)},
+		{Start: at(13), End: at(14)},
+	}, merge([]Block{
+		{Start: at(13), End: at(14)},
+		{Start: at(9), End: at(10)},
+		{Start: at(8), End: at(11)},
+		{Start: at(11), End: at(12)},
+	}))
+}
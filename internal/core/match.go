@@ -0,0 +1,169 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/source"
+	"google.golang.org/api/calendar/v3"
+)
+
+// Matcher decides whether an event belongs to a category.
+type Matcher interface {
+	Matches(event *calendar.Event) bool
+}
+
+// Field returns the values of some property of an event. Most properties have at most one value,
+// but for example an event may have many attendees.
+type Field func(event *calendar.Event) []string
+
+// Fields maps names of event properties which can be matched on to functions returning their values.
+var Fields = map[string]Field{
+	"summary":     func(e *calendar.Event) []string { return []string{e.Summary} },
+	"description": func(e *calendar.Event) []string { return []string{e.Description} },
+	"location":    func(e *calendar.Event) []string { return []string{e.Location} },
+	"color":       func(e *calendar.Event) []string { return []string{e.ColorId} },
+	"type":        eventType,
+	"calendar":    func(e *calendar.Event) []string { return []string{source.CalendarOf(e)} },
+	"organizer":   organizerEmails,
+	"attendee":    attendeeEmails,
+	"organizer_domain": func(e *calendar.Event) []string {
+		return domains(organizerEmails(e))
+	},
+	"attendee_domain": func(e *calendar.Event) []string {
+		return domains(attendeeEmails(e))
+	},
+}
+
+func eventType(e *calendar.Event) []string {
+	if e.EventType == "" {
+		// This is what the API returns for events created before event types were introduced.
+		return []string{"default"}
+	}
+	return []string{e.EventType}
+}
+
+func organizerEmails(e *calendar.Event) []string {
+	if e.Organizer == nil {
+		return nil
+	}
+	return []string{e.Organizer.Email}
+}
+
+func attendeeEmails(e *calendar.Event) []string {
+	var ret []string
+	for _, attendee := range e.Attendees {
+		ret = append(ret, attendee.Email)
+	}
+	return ret
+}
+
+func domains(emails []string) []string {
+	var ret []string
+	for _, email := range emails {
+		if _, domain, ok := strings.Cut(email, "@"); ok {
+			ret = append(ret, domain)
+		}
+	}
+	return ret
+}
+
+// RegexpMatcher matches events where any value of the field matches the pattern.
+type RegexpMatcher struct {
+	Field   Field
+	Pattern *regexp.Regexp
+}
+
+func (m *RegexpMatcher) Matches(event *calendar.Event) bool {
+	for _, v := range m.Field(event) {
+		if m.Pattern.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValueMatcher matches events where any value of the field is equal to the value, ignoring case.
+type ValueMatcher struct {
+	Field Field
+	Value string
+}
+
+func (m *ValueMatcher) Matches(event *calendar.Event) bool {
+	for _, v := range m.Field(event) {
+		if strings.EqualFold(v, m.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllOf matches events which all of its matchers match.
+type AllOf []Matcher
+
+func (a AllOf) Matches(event *calendar.Event) bool {
+	for _, m := range a {
+		if !m.Matches(event) {
+			return false
+		}
+	}
+	return true
+}
+
+// AnyOf matches events which any of its matchers matches.
+type AnyOf []Matcher
+
+func (a AnyOf) Matches(event *calendar.Event) bool {
+	for _, m := range a {
+		if m.Matches(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Not matches events which its matcher does not match.
+type Not struct {
+	Matcher
+}
+
+func (n Not) Matches(event *calendar.Event) bool {
+	return !n.Matcher.Matches(event)
+}
+
+// DurationMatcher matches events by their scheduled duration.
+type DurationMatcher struct {
+	// LongerThan and ShorterThan are exclusive bounds of the duration, zero means no bound.
+	LongerThan, ShorterThan time.Duration
+}
+
+func (m *DurationMatcher) Matches(event *calendar.Event) bool {
+	start, end, ok := source.Times(event)
+	if !ok {
+		return false
+	}
+	d := end.Sub(start)
+	if m.LongerThan != 0 && d <= m.LongerThan {
+		return false
+	}
+	if m.ShorterThan != 0 && d >= m.ShorterThan {
+		return false
+	}
+	return true
+}
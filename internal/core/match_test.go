@@ -0,0 +1,75 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/source"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestMatchers(t *testing.T) {
+	event := &calendar.Event{
+		Summary:     "sync",
+		Description: "Quarterly planning",
+		Location:    "Room 101",
+		ColorId:     "11",
+		Organizer:   &calendar.EventOrganizer{Email: "boss@example.com"},
+		Attendees: []*calendar.EventAttendee{
+			{Email: "me@example.com"},
+			{Email: "someone@Customer.com"},
+		},
+	}
+	source.SetCalendar(event, "work")
+	tests := []struct {
+		name    string
+		matcher Matcher
+		want    bool
+	}{
+		{"description", &RegexpMatcher{Fields["description"], regexp.MustCompile("planning")}, true},
+		{"location", &RegexpMatcher{Fields["location"], regexp.MustCompile("^Room 2")}, false},
+		{"organizer", &RegexpMatcher{Fields["organizer"], regexp.MustCompile("^boss@")}, true},
+		{"any attendee", &RegexpMatcher{Fields["attendee"], regexp.MustCompile("^someone@")}, true},
+		{"color", &ValueMatcher{Fields["color"], "11"}, true},
+		{"default type", &ValueMatcher{Fields["type"], "default"}, true},
+		{"calendar", &ValueMatcher{Fields["calendar"], "personal"}, false},
+		{"organizer domain", &ValueMatcher{Fields["organizer_domain"], "customer.com"}, false},
+		{"attendee domain ignores case", &ValueMatcher{Fields["attendee_domain"], "customer.com"}, true},
+		{"all of", AllOf{
+			&ValueMatcher{Fields["calendar"], "work"},
+			&RegexpMatcher{Fields["summary"], regexp.MustCompile("sync")},
+		}, true},
+		{"not all of", AllOf{
+			&ValueMatcher{Fields["calendar"], "work"},
+			&RegexpMatcher{Fields["summary"], regexp.MustCompile("review")},
+		}, false},
+		{"any of", AnyOf{
+			&ValueMatcher{Fields["calendar"], "personal"},
+			&RegexpMatcher{Fields["summary"], regexp.MustCompile("sync")},
+		}, true},
+		{"not", Not{&ValueMatcher{Fields["calendar"], "work"}}, false},
+		{"duration of event without times", &DurationMatcher{ShorterThan: time.Hour}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.matcher.Matches(event))
+		})
+	}
+}
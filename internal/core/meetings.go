@@ -0,0 +1,140 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	// Alone is the size of events without other attendees.
+	Alone = "alone"
+	// OneOnOne is the size of meetings with one other attendee.
+	OneOnOne = "1:1"
+)
+
+// MeetingSizes lists names of meeting sizes, from the smallest. Sizes count attendees, including you.
+var MeetingSizes = []string{Alone, OneOnOne, "3-5", "6-10", "11+"}
+
+// EventTypeDimension tags events with their type, telling for example focus time apart from regular events.
+var EventTypeDimension = &Dimension{Name: "event type", Tags: []*Category{
+	{Name: "regular", Rules: []Matcher{&ValueMatcher{Field: Fields["type"], Value: "default"}}},
+	{Name: "focusTime", Rules: []Matcher{&ValueMatcher{Field: Fields["type"], Value: "focusTime"}}},
+	{Name: "outOfOffice", Rules: []Matcher{&ValueMatcher{Field: Fields["type"], Value: "outOfOffice"}}},
+	{Name: "workingLocation", Rules: []Matcher{&ValueMatcher{Field: Fields["type"], Value: "workingLocation"}}},
+}}
+
+// Meetings is time spent in events split by who else attended them.
+type Meetings struct {
+	// Sizes maps names from MeetingSizes to time spent in meetings of that size.
+	Sizes map[string]time.Duration
+	// Organizers maps email addresses of people other than you who organized events to time spent in them.
+	Organizers map[string]time.Duration
+	// ExternalDomains maps domains of attendees from outside of your organization to time spent in meetings with them.
+	// A meeting with attendees from several such domains counts towards each of them.
+	ExternalDomains map[string]time.Duration
+}
+
+func newMeetings() *Meetings {
+	return &Meetings{
+		Sizes:           make(map[string]time.Duration),
+		Organizers:      make(map[string]time.Duration),
+		ExternalDomains: make(map[string]time.Duration),
+	}
+}
+
+// meeting is what matters about an event for Meetings.
+type meeting struct {
+	size            string
+	organizer       string
+	externalDomains []string
+}
+
+func (m *Meetings) add(mt *meeting, d time.Duration) {
+	m.Sizes[mt.size] += d
+	if mt.organizer != "" {
+		m.Organizers[mt.organizer] += d
+	}
+	for _, domain := range mt.externalDomains {
+		m.ExternalDomains[domain] += d
+	}
+}
+
+// newMeeting describes the event. Attendees which are resources, such as rooms, or which declined are not counted.
+// Domains are external unless they are among internalDomains, or if there are none, the domain of your own address.
+func newMeeting(event *calendar.Event, internalDomains []string) *meeting {
+	m := &meeting{}
+	if event.Organizer != nil && !event.Organizer.Self {
+		m.organizer = strings.ToLower(event.Organizer.Email)
+	}
+	if len(internalDomains) == 0 {
+		internalDomains = selfDomains(event)
+	}
+	size := 0
+	for _, attendee := range event.Attendees {
+		if attendee.Resource || attendee.ResponseStatus == "declined" {
+			continue
+		}
+		size++
+		domain := strings.ToLower(domainOf(attendee.Email))
+		if domain == "" || attendee.Self || slices.ContainsFunc(internalDomains, func(d string) bool { return strings.EqualFold(d, domain) }) {
+			continue
+		}
+		if !slices.Contains(m.externalDomains, domain) {
+			m.externalDomains = append(m.externalDomains, domain)
+		}
+	}
+	m.size = meetingSize(size)
+	return m
+}
+
+func meetingSize(attendees int) string {
+	switch {
+	case attendees <= 1:
+		return Alone
+	case attendees == 2:
+		return OneOnOne
+	case attendees <= 5:
+		return "3-5"
+	case attendees <= 10:
+		return "6-10"
+	default:
+		return "11+"
+	}
+}
+
+// selfDomains returns the domains of your own addresses found in the event.
+func selfDomains(event *calendar.Event) []string {
+	var ret []string
+	if event.Organizer != nil && event.Organizer.Self {
+		ret = append(ret, domainOf(event.Organizer.Email))
+	}
+	for _, attendee := range event.Attendees {
+		if attendee.Self {
+			ret = append(ret, domainOf(attendee.Email))
+		}
+	}
+	return ret
+}
+
+func domainOf(email string) string {
+	_, domain, _ := strings.Cut(email, "@")
+	return domain
+}
@@ -0,0 +1,72 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestComputeMeetings(t *testing.T) {
+	withAttendees := func(e *calendar.Event, organizer string, emails ...string) *calendar.Event {
+		e.Organizer = &calendar.EventOrganizer{Email: organizer, Self: organizer == "me@example.com"}
+		for _, email := range emails {
+			e.Attendees = append(e.Attendees, &calendar.EventAttendee{Email: email, Self: email == "me@example.com", ResponseStatus: "accepted"})
+		}
+		return e
+	}
+	room := withAttendees(newEvent("2023-03-27T11:00:00Z", "2023-03-27T12:00:00Z", "1:1 with a room"), "me@example.com", "me@example.com", "boss@example.com", "room@resource.example.com")
+	room.Attendees[2].Resource = true
+	declined := withAttendees(newEvent("2023-03-27T13:00:00Z", "2023-03-27T14:00:00Z", "sync"), "pm@example.com", "pm@example.com", "me@example.com", "dev@example.com", "vendor@acme.com")
+	declined.Attendees[2].ResponseStatus = "declined"
+	events := []*calendar.Event{
+		newEvent("2023-03-27T08:00:00Z", "2023-03-27T09:00:00Z", "focus"),
+		withAttendees(newEvent("2023-03-27T09:00:00Z", "2023-03-27T10:00:00Z", "1:1"), "boss@example.com", "boss@example.com", "me@example.com"),
+		withAttendees(newEvent("2023-03-27T10:00:00Z", "2023-03-27T10:30:00Z", "customer call"), "me@example.com", "me@example.com", "a@acme.com", "b@acme.com", "c@other.org"),
+		room,
+		declined,
+	}
+
+	totals := Compute(events, nil, Options{Location: time.UTC})
+	assert.Equal(t, &Meetings{
+		Sizes: map[string]time.Duration{
+			Alone:    time.Hour,
+			OneOnOne: 2 * time.Hour,
+			"3-5":    90 * time.Minute,
+		},
+		Organizers: map[string]time.Duration{
+			"boss@example.com": time.Hour,
+			"pm@example.com":   time.Hour,
+		},
+		ExternalDomains: map[string]time.Duration{
+			"acme.com":  90 * time.Minute,
+			"other.org": 30 * time.Minute,
+		},
+	}, totals.Meetings)
+
+	totals = Compute(events, nil, Options{Location: time.UTC, InternalDomains: []string{"example.com", "acme.com"}})
+	assert.Equal(t, map[string]time.Duration{"other.org": 30 * time.Minute}, totals.Meetings.ExternalDomains)
+}
+
+func TestEventTypeDimension(t *testing.T) {
+	focus := newEvent("2023-03-27T08:00:00Z", "2023-03-27T09:00:00Z")
+	focus.EventType = "focusTime"
+	assert.Equal(t, CategoryName("focusTime"), EventTypeDimension.tag(focus))
+	assert.Equal(t, CategoryName("regular"), EventTypeDimension.tag(newEvent("2023-03-27T08:00:00Z", "2023-03-27T09:00:00Z")))
+}
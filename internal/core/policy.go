@@ -0,0 +1,118 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"log"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Policy decides which events are counted. Its zero value counts events you organized,
+// and invitations you accepted, except for all-day, out of office and working location events.
+type Policy struct {
+	// Tentative makes invitations answered with "maybe" count.
+	Tentative bool
+	// Unanswered makes invitations which were not answered count.
+	Unanswered bool
+	// SkipFocusTime makes focus time events not count.
+	SkipFocusTime bool
+	// SkipTransparent makes events which do not block time (shown as "free") not count.
+	SkipTransparent bool
+	// OutOfOffice and WorkingLocation make events of these types count.
+	OutOfOffice     bool
+	WorkingLocation bool
+}
+
+// Exclusion is the reason for not counting an event.
+type Exclusion string
+
+const (
+	AllDay          = Exclusion("all-day")
+	OutOfOffice     = Exclusion("outOfOffice")
+	WorkingLocation = Exclusion("workingLocation")
+	FocusTime       = Exclusion("focusTime")
+	Transparent     = Exclusion("transparent")
+	Declined        = Exclusion("declined")
+	NotAccepted     = Exclusion("not accepted")
+	SelfNotFound    = Exclusion("self not found")
+	InvalidTime     = Exclusion("invalid time")
+	OutsideRange    = Exclusion("outside time range")
+)
+
+func shouldConsider(event *calendar.Event, policy Policy) bool {
+	reason := policy.exclusionReason(event)
+	if reason == SelfNotFound {
+		log.Printf("self not found among attendees of %+v %+v", event.Organizer, event.Creator)
+	}
+	return reason == ""
+}
+
+// exclusionReason returns why the event should not be counted, or empty string if it should.
+func (p Policy) exclusionReason(event *calendar.Event) Exclusion {
+	if event.Start.DateTime == "" {
+		// full-day event
+		return AllDay
+	}
+	switch {
+	case event.EventType == "outOfOffice" && !p.OutOfOffice:
+		return OutOfOffice
+	case event.EventType == "workingLocation" && !p.WorkingLocation:
+		return WorkingLocation
+	case event.EventType == "focusTime" && p.SkipFocusTime:
+		return FocusTime
+	case event.Transparency == "transparent" && p.SkipTransparent:
+		return Transparent
+	}
+	return p.attendance(event)
+}
+
+// attendance returns why the event should not be counted given your response to it, or empty string if it should.
+func (p Policy) attendance(event *calendar.Event) Exclusion {
+	for _, attendee := range event.Attendees {
+		if attendee.Self && attendee.ResponseStatus == "declined" {
+			return Declined
+		}
+	}
+	if event.Organizer != nil && event.Organizer.Self {
+		return ""
+	}
+	if event.Creator != nil && event.Creator.Self {
+		return ""
+	}
+	for _, attendee := range event.Attendees {
+		if attendee.Self {
+			if p.counts(attendee.ResponseStatus) {
+				return ""
+			}
+			return NotAccepted
+		}
+	}
+	return SelfNotFound
+}
+
+// counts returns true if invitations with the given response should count.
+func (p Policy) counts(responseStatus string) bool {
+	switch responseStatus {
+	case "accepted":
+		return true
+	case "tentative":
+		return p.Tentative
+	case "needsAction":
+		return p.Unanswered
+	}
+	return false
+}
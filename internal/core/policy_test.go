@@ -0,0 +1,64 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestPolicy(t *testing.T) {
+	invitation := func(response string) *calendar.Event {
+		e := newEvent("2023-03-27T09:00:00Z", "2023-03-27T10:00:00Z")
+		e.Organizer.Self = false
+		e.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: response}}
+		return e
+	}
+	ofType := func(eventType string) *calendar.Event {
+		e := newEvent("2023-03-27T09:00:00Z", "2023-03-27T10:00:00Z")
+		e.EventType = eventType
+		return e
+	}
+	transparent := newEvent("2023-03-27T09:00:00Z", "2023-03-27T10:00:00Z")
+	transparent.Transparency = "transparent"
+	tests := []struct {
+		name   string
+		event  *calendar.Event
+		policy Policy
+		want   Exclusion
+	}{
+		{"accepted", invitation("accepted"), Policy{}, ""},
+		{"tentative", invitation("tentative"), Policy{}, NotAccepted},
+		{"tentative included", invitation("tentative"), Policy{Tentative: true}, ""},
+		{"unanswered", invitation("needsAction"), Policy{Tentative: true}, NotAccepted},
+		{"unanswered included", invitation("needsAction"), Policy{Unanswered: true}, ""},
+		{"declined always excluded", invitation("declined"), Policy{Tentative: true, Unanswered: true}, Declined},
+		{"focus time", ofType("focusTime"), Policy{}, ""},
+		{"focus time skipped", ofType("focusTime"), Policy{SkipFocusTime: true}, FocusTime},
+		{"transparent", transparent, Policy{}, ""},
+		{"transparent skipped", transparent, Policy{SkipTransparent: true}, Transparent},
+		{"out of office", ofType("outOfOffice"), Policy{}, OutOfOffice},
+		{"out of office included", ofType("outOfOffice"), Policy{OutOfOffice: true}, ""},
+		{"working location included", ofType("workingLocation"), Policy{WorkingLocation: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.exclusionReason(tt.event))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/porridge/calendar-stats/internal/ordererd"
+)
+
+// TimeRange is a part of a day, from Start up to End.
+type TimeRange struct {
+	Start, End civil.Time
+}
+
+// Schedule tells when work is expected.
+type Schedule struct {
+	// Location is the time zone of Hours and Holidays.
+	Location *time.Location
+	// Hours lists working hours on each day of the week.
+	Hours map[time.Weekday][]TimeRange
+	// Holidays maps dates on which no work is expected to their names.
+	Holidays map[civil.Date]string
+}
+
+// hours returns the working hours on the given date.
+func (s *Schedule) hours(day civil.Date) []TimeRange {
+	if _, ok := s.Holidays[day]; ok {
+		return nil
+	}
+	return s.Hours[day.In(time.UTC).Weekday()]
+}
+
+// blocks returns the working hours between start and end, in chronological order.
+func (s *Schedule) blocks(start, end time.Time) []Block {
+	var ret []Block
+	for day := civil.DateOf(start.In(s.Location)); day.In(s.Location).Before(end); day = day.AddDays(1) {
+		for _, r := range s.hours(day) {
+			rangeStart := civil.DateTime{Date: day, Time: r.Start}.In(s.Location)
+			rangeEnd := civil.DateTime{Date: day, Time: r.End}.In(s.Location)
+			if from, to, isInside := clip(start, end, rangeStart, rangeEnd); isInside {
+				ret = append(ret, Block{Start: from, End: to})
+			}
+		}
+	}
+	return ret
+}
+
+// overlap returns how much of the time between start and end falls within working hours.
+func (s *Schedule) overlap(start, end time.Time) time.Duration {
+	var ret time.Duration
+	for _, b := range s.blocks(start, end) {
+		ret += b.Duration()
+	}
+	return ret
+}
+
+// scheduledRange returns the time range for which working hours are considered: the one in the options,
+// or the days with events, if it is not limited. It returns false if there is no such range.
+func scheduledRange(totals *Totals, opts Options) (time.Time, time.Time, bool) {
+	from, to := opts.Start, opts.End
+	if from.IsZero() || to.IsZero() {
+		days := ordererd.KeysOfMap(totals.Days, ordererd.CivilDates)
+		if len(days) == 0 {
+			return from, to, false
+		}
+		if from.IsZero() {
+			from = days[0].In(opts.Location)
+		}
+		if to.IsZero() {
+			to = days[len(days)-1].AddDays(1).In(opts.Location)
+		}
+	}
+	return from, to, true
+}
+
+// expect fills in the working time expected on each day within the scheduled range.
+func expect(totals *Totals, opts Options) {
+	from, to, ok := scheduledRange(totals, opts)
+	if !ok {
+		return
+	}
+	for day := civil.DateOf(from.In(opts.Location)); day.In(opts.Location).Before(to); day = day.AddDays(1) {
+		dayStart, dayEnd, _ := clip(day.In(opts.Location), day.AddDays(1).In(opts.Location), from, to)
+		if expected := opts.Schedule.overlap(dayStart, dayEnd); expected > 0 {
+			totals.Expected[day] = expected
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestComputeSchedule(t *testing.T) {
+	hours := []TimeRange{
+		{Start: civil.Time{Hour: 9}, End: civil.Time{Hour: 12}},
+		{Start: civil.Time{Hour: 13}, End: civil.Time{Hour: 17}},
+	}
+	schedule := &Schedule{
+		Location: time.UTC,
+		Hours: map[time.Weekday][]TimeRange{
+			time.Monday: hours, time.Tuesday: hours, time.Wednesday: hours, time.Thursday: hours, time.Friday: hours,
+		},
+		Holidays: map[civil.Date]string{{Year: 2023, Month: 3, Day: 29}: "holiday"},
+	}
+	events := []*calendar.Event{
+		newEvent("2023-03-27T08:00:00Z", "2023-03-27T10:00:00Z", "early"),
+		newEvent("2023-03-27T12:00:00Z", "2023-03-27T13:00:00Z", "lunch"),
+		newEvent("2023-03-28T16:00:00Z", "2023-03-28T18:00:00Z", "late"),
+		newEvent("2023-03-29T10:00:00Z", "2023-03-29T11:00:00Z", "on a holiday"),
+	}
+	opts := Options{
+		Location: time.UTC,
+		Start:    time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+		Schedule: schedule,
+	}
+
+	totals := Compute(events, nil, opts)
+	assert.Equal(t, map[civil.Date]time.Duration{
+		{Year: 2023, Month: 3, Day: 27}: 7 * time.Hour,
+		{Year: 2023, Month: 3, Day: 28}: 7 * time.Hour,
+		{Year: 2023, Month: 3, Day: 30}: 7 * time.Hour,
+		{Year: 2023, Month: 3, Day: 31}: 7 * time.Hour,
+	}, totals.Expected)
+	assert.Equal(t, map[civil.Date]time.Duration{
+		{Year: 2023, Month: 3, Day: 27}: time.Hour,
+		{Year: 2023, Month: 3, Day: 28}: time.Hour,
+	}, totals.WithinHours)
+
+	t.Run("partial days", func(t *testing.T) {
+		opts := opts
+		opts.Start = time.Date(2023, 3, 27, 10, 0, 0, 0, time.UTC)
+		opts.End = time.Date(2023, 3, 28, 14, 0, 0, 0, time.UTC)
+		totals := Compute(events, nil, opts)
+		assert.Equal(t, map[civil.Date]time.Duration{
+			{Year: 2023, Month: 3, Day: 27}: 6 * time.Hour,
+			{Year: 2023, Month: 3, Day: 28}: 4 * time.Hour,
+		}, totals.Expected)
+	})
+
+	t.Run("time zone", func(t *testing.T) {
+		opts := opts
+		opts.Schedule = &Schedule{
+			Location: time.FixedZone("UTC+2", 2*60*60),
+			Hours:    schedule.Hours,
+		}
+		totals := Compute(events[:1], nil, opts)
+		// 9:00 in UTC+2 is 7:00 UTC, so all of the early event is within working hours.
+		assert.Equal(t, 2*time.Hour, totals.WithinHours[civil.Date{Year: 2023, Month: 3, Day: 27}])
+	})
+}
@@ -0,0 +1,69 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Series is time spent in instances of a recurring event.
+type Series struct {
+	// Summary is the summary of the first instance seen.
+	Summary string
+	// Time is the time spent in counted instances.
+	Time time.Duration
+	// Attended and Declined count instances which were counted, and ones which you declined.
+	Attended, Declined int
+}
+
+// AverageDuration returns the average time spent in an attended instance.
+func (s *Series) AverageDuration() time.Duration {
+	if s.Attended == 0 {
+		return 0
+	}
+	return s.Time / time.Duration(s.Attended)
+}
+
+// series returns the series which the event is an instance of, or nil if it is not recurring.
+func (t *Totals) series(event *calendar.Event) *Series {
+	if event.RecurringEventId == "" {
+		return nil
+	}
+	s := t.Series[event.RecurringEventId]
+	if s == nil {
+		s = &Series{Summary: event.Summary}
+		t.Series[event.RecurringEventId] = s
+	}
+	return s
+}
+
+// countDeclined counts declined instances of recurring events within the time range.
+func countDeclined(totals *Totals, events []*calendar.Event, opts Options) {
+	for _, event := range events {
+		if event.RecurringEventId == "" || opts.Policy.attendance(event) != Declined {
+			continue
+		}
+		evStart, evEnd, ok := eventDays(event, opts.Location)
+		if !ok {
+			continue
+		}
+		if _, _, isInside := clip(evStart, evEnd, opts.Start, opts.End); isInside {
+			totals.series(event).Declined++
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestComputeSeries(t *testing.T) {
+	instance := func(start, end, series string) *calendar.Event {
+		e := newEvent(start, end, series)
+		e.RecurringEventId = series
+		return e
+	}
+	declined := instance("2023-03-28T09:00:00Z", "2023-03-28T09:15:00Z", "standup")
+	declined.Organizer.Self = false
+	declined.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: "declined"}}
+	outside := instance("2023-04-03T09:00:00Z", "2023-04-03T09:15:00Z", "standup")
+	outside.Organizer.Self = false
+	outside.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: "declined"}}
+	events := []*calendar.Event{
+		instance("2023-03-27T09:00:00Z", "2023-03-27T09:15:00Z", "standup"),
+		declined,
+		instance("2023-03-29T09:00:00Z", "2023-03-29T09:25:00Z", "standup"),
+		outside,
+		instance("2023-03-27T14:00:00Z", "2023-03-27T15:00:00Z", "planning"),
+		newEvent("2023-03-27T09:00:00Z", "2023-03-27T09:15:00Z", "one-off"),
+	}
+	totals := Compute(events, nil, Options{
+		Location: time.UTC,
+		Start:    time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC),
+	})
+	assert.Equal(t, map[string]*Series{
+		// The first instance overlaps with the one-off event, so only half of its time counts.
+		"standup":  {Summary: "standup", Time: 32*time.Minute + 30*time.Second, Attended: 2, Declined: 1},
+		"planning": {Summary: "planning", Time: time.Hour, Attended: 1},
+	}, totals.Series)
+	assert.Equal(t, 16*time.Minute+15*time.Second, totals.Series["standup"].AverageDuration())
+}
@@ -11,37 +11,118 @@ type span struct {
 	start      time.Time
 	events     map[*calendar.Event]CategoryName
 	categories []*Category
+	// tags maps events to their tags, in the order of dimensions.
+	tags       map[*calendar.Event][]CategoryName
+	dimensions []*Dimension
+	// inlineTags maps events to tags written in them.
+	inlineTags      map[*calendar.Event][]string
+	inlineTagsField Field
+	schedule        *Schedule
+	// meetings maps events to what matters about them for meeting statistics.
+	meetings        map[*calendar.Event]*meeting
+	internalDomains []string
+	// lastActivity is the activity of the previous span with events, and lastDay is its day.
+	lastActivity string
+	lastDay      civil.Date
 }
 
-func newSpan(categories []*Category) *span {
-	return &span{categories: categories, events: make(map[*calendar.Event]CategoryName)}
+func newSpan(categories []*Category, opts Options) *span {
+	return &span{
+		categories:      categories,
+		events:          make(map[*calendar.Event]CategoryName),
+		dimensions:      opts.Dimensions,
+		tags:            make(map[*calendar.Event][]CategoryName),
+		inlineTags:      make(map[*calendar.Event][]string),
+		inlineTagsField: InlineTagsField(opts.DescriptionTags),
+		schedule:        opts.Schedule,
+		meetings:        make(map[*calendar.Event]*meeting),
+		internalDomains: opts.InternalDomains,
+	}
 }
 
-func (s *span) checkpoint(dayTotals map[civil.Date]time.Duration, categoryTotals map[CategoryName]time.Duration, end time.Time) {
+func (s *span) checkpoint(totals *Totals, end time.Time) {
 	timeSpent := end.Sub(s.start)
 	eventCount := len(s.events)
 	var timePerEvent int64
+	day := civil.DateOf(s.start)
 	if eventCount > 0 {
 		timePerEvent = int64(timeSpent) / int64(eventCount)
-		dayTotals[civil.DateOf(s.start)] += timeSpent
+		totals.Days[day] += timeSpent
+		if totals.DayCategories[day] == nil {
+			totals.DayCategories[day] = make(map[CategoryName]time.Duration)
+		}
+		if within := s.withinHours(end); within > 0 {
+			totals.WithinHours[day] += within
+		}
+		s.countSwitch(totals, day, timeSpent)
 	}
-	for _, categoryName := range s.events {
-		categoryTotals[categoryName] += time.Duration(timePerEvent)
+	for event, categoryName := range s.events {
+		totals.Categories[categoryName] += time.Duration(timePerEvent)
+		totals.DayCategories[day][categoryName] += time.Duration(timePerEvent)
+		for i, tag := range s.tags[event] {
+			totals.Dimensions[s.dimensions[i].Name][tag] += time.Duration(timePerEvent)
+		}
+		for _, tag := range s.inlineTags[event] {
+			totals.Tags[tag] += time.Duration(timePerEvent)
+		}
+		totals.Meetings.add(s.meetings[event], time.Duration(timePerEvent))
+		if series := totals.series(event); series != nil {
+			series.Time += time.Duration(timePerEvent)
+		}
 	}
 	s.start = end
 }
 
+// countSwitch accounts for the span, which lasts the given time on the given day, in the switching totals.
+func (s *span) countSwitch(totals *Totals, day civil.Date, timeSpent time.Duration) {
+	switching := totals.Switching[day]
+	if switching == nil {
+		switching = &Switching{}
+		totals.Switching[day] = switching
+	}
+	switching.Time += timeSpent
+	activity := s.activity()
+	switch {
+	case day != s.lastDay:
+		switching.Stretches++
+	case activity != s.lastActivity:
+		switching.Stretches++
+		switching.Switches++
+	}
+	s.lastActivity, s.lastDay = activity, day
+}
+
+// withinHours returns the part of the span until the given time, which falls within working hours.
+func (s *span) withinHours(end time.Time) time.Duration {
+	if s.schedule == nil {
+		return 0
+	}
+	return s.schedule.overlap(s.start, end)
+}
+
 func (s *span) eventEnd(event *calendar.Event) {
 	delete(s.events, event)
+	delete(s.tags, event)
+	delete(s.inlineTags, event)
+	delete(s.meetings, event)
 }
 
 // eventStart returns false if the event was not recognized to belong to a category.
 func (s *span) eventStart(event *calendar.Event) bool {
-	for _, aCategory := range s.categories {
-		if aCategory.recognizes(event) {
-			s.events[event] = aCategory.Name
-			return true
+	if len(s.dimensions) > 0 {
+		tags := make([]CategoryName, len(s.dimensions))
+		for i, d := range s.dimensions {
+			tags[i] = d.tag(event)
 		}
+		s.tags[event] = tags
+	}
+	if tags := s.inlineTagsField(event); len(tags) > 0 {
+		s.inlineTags[event] = tags
+	}
+	s.meetings[event] = newMeeting(event, s.internalDomains)
+	if aCategory := categorize(s.categories, event); aCategory != nil {
+		s.events[event] = aCategory.Name
+		return true
 	}
 	s.events[event] = Uncategorized
 	return false
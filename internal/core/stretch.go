@@ -0,0 +1,73 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/source"
+	"google.golang.org/api/calendar/v3"
+)
+
+// StretchRule changes the duration of matching events, keeping their start time.
+type StretchRule struct {
+	// Min and Max are the inclusive bounds of the duration of events the rule applies to.
+	Min, Max time.Duration
+	// To is the new duration of matching events. Events already longer than that are left alone.
+	To time.Duration
+	// Category, if not empty, limits the rule to events in this category or its descendants.
+	Category CategoryName
+	// Calendar, if not empty, limits the rule to events read from this calendar.
+	Calendar string
+}
+
+// DefaultStretchRules are used unless configured otherwise.
+// Speedy meetings are a lie. They usually last until the full half hour anyway.
+var DefaultStretchRules = []StretchRule{
+	{Min: 50 * time.Minute, Max: 50 * time.Minute, To: 1 * time.Hour},
+	{Min: 40 * time.Minute, Max: 40 * time.Minute, To: 45 * time.Minute},
+	{Min: 25 * time.Minute, Max: 25 * time.Minute, To: 30 * time.Minute},
+}
+
+func (r *StretchRule) matches(d time.Duration, categories []*Category, event *calendar.Event) bool {
+	if d < r.Min || d > r.Max {
+		return false
+	}
+	if r.Calendar != "" && source.CalendarOf(event) != r.Calendar {
+		return false
+	}
+	if r.Category != "" {
+		aCategory := categorize(categories, event)
+		if aCategory == nil || !aCategory.Name.Within(r.Category) {
+			return false
+		}
+	}
+	return true
+}
+
+// stretch delays evEnd according to the first matching rule, if any. It never moves evEnd earlier.
+func stretch(rules []StretchRule, categories []*Category, event *calendar.Event, evStart, evEnd time.Time) (time.Time, time.Time) {
+	d := evEnd.Sub(evStart)
+	for _, rule := range rules {
+		if rule.matches(d, categories, event) {
+			if stretched := evStart.Add(rule.To); stretched.After(evEnd) {
+				return evStart, stretched
+			}
+			return evStart, evEnd
+		}
+	}
+	return evStart, evEnd
+}
@@ -0,0 +1,137 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/porridge/calendar-stats/internal/source"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestStretch(t *testing.T) {
+	categories := []*Category{
+		{Name: "meetings", Patterns: []*regexp.Regexp{regexp.MustCompile("meeting")}},
+	}
+	start := time.Date(2023, 3, 25, 13, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		rules    []StretchRule
+		duration time.Duration
+		summary  string
+		calendar string
+		want     time.Duration
+	}{
+		{name: "default 50m", rules: DefaultStretchRules, duration: 50 * time.Minute, want: time.Hour},
+		{name: "default 40m", rules: DefaultStretchRules, duration: 40 * time.Minute, want: 45 * time.Minute},
+		{name: "default 25m", rules: DefaultStretchRules, duration: 25 * time.Minute, want: 30 * time.Minute},
+		{name: "default leaves others alone", rules: DefaultStretchRules, duration: 45 * time.Minute, want: 45 * time.Minute},
+		{name: "no rules", duration: 50 * time.Minute, want: 50 * time.Minute},
+		{
+			name:     "exact",
+			rules:    []StretchRule{{Min: 45 * time.Minute, Max: 45 * time.Minute, To: time.Hour}},
+			duration: 45 * time.Minute,
+			want:     time.Hour,
+		},
+		{
+			name:     "range",
+			rules:    []StretchRule{{Min: 15 * time.Minute, Max: 25 * time.Minute, To: 30 * time.Minute}},
+			duration: 20 * time.Minute,
+			want:     30 * time.Minute,
+		},
+		{
+			name:     "outside range",
+			rules:    []StretchRule{{Min: 15 * time.Minute, Max: 25 * time.Minute, To: 30 * time.Minute}},
+			duration: 26 * time.Minute,
+			want:     26 * time.Minute,
+		},
+		{
+			name:     "never shortens",
+			rules:    []StretchRule{{Min: 15 * time.Minute, Max: time.Hour, To: 30 * time.Minute}},
+			duration: 45 * time.Minute,
+			want:     45 * time.Minute,
+		},
+		{
+			name:     "never ends before start",
+			rules:    []StretchRule{{Min: 50 * time.Minute, Max: 50 * time.Minute, To: -time.Hour}},
+			duration: 50 * time.Minute,
+			want:     50 * time.Minute,
+		},
+		{
+			name: "first matching rule wins",
+			rules: []StretchRule{
+				{Min: 20 * time.Minute, Max: 20 * time.Minute, To: 25 * time.Minute},
+				{Min: 0, Max: time.Hour, To: time.Hour},
+			},
+			duration: 20 * time.Minute,
+			want:     25 * time.Minute,
+		},
+		{
+			name:     "category matches",
+			rules:    []StretchRule{{Min: 20 * time.Minute, Max: 20 * time.Minute, To: 30 * time.Minute, Category: "meetings"}},
+			duration: 20 * time.Minute,
+			summary:  "team meeting",
+			want:     30 * time.Minute,
+		},
+		{
+			name:     "category does not match",
+			rules:    []StretchRule{{Min: 20 * time.Minute, Max: 20 * time.Minute, To: 30 * time.Minute, Category: "meetings"}},
+			duration: 20 * time.Minute,
+			summary:  "reading mail",
+			want:     20 * time.Minute,
+		},
+		{
+			name:     "calendar matches",
+			rules:    []StretchRule{{Min: 20 * time.Minute, Max: 20 * time.Minute, To: 30 * time.Minute, Calendar: "team"}},
+			duration: 20 * time.Minute,
+			calendar: "team",
+			want:     30 * time.Minute,
+		},
+		{
+			name:     "calendar does not match",
+			rules:    []StretchRule{{Min: 20 * time.Minute, Max: 20 * time.Minute, To: 30 * time.Minute, Calendar: "team"}},
+			duration: 20 * time.Minute,
+			calendar: "primary",
+			want:     20 * time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := newEvent(start.Format(time.RFC3339), start.Add(tt.duration).Format(time.RFC3339), tt.summary)
+			if tt.calendar != "" {
+				source.SetCalendar(event, tt.calendar)
+			}
+			gotStart, gotEnd := stretch(tt.rules, categories, event, start, start.Add(tt.duration))
+			assert.Equal(t, start, gotStart)
+			assert.Equal(t, tt.want, gotEnd.Sub(gotStart))
+		})
+	}
+}
+
+func TestComputeStretchesBeforeAccounting(t *testing.T) {
+	events := []*calendar.Event{
+		newEvent("2023-03-25T13:00:00+00:00", "2023-03-25T13:45:00+00:00", "meeting"),
+	}
+	got := Compute(events, nil, Options{
+		Location: time.UTC,
+		Stretch:  []StretchRule{{Min: 45 * time.Minute, Max: 45 * time.Minute, To: time.Hour}},
+	})
+	assert.Equal(t, time.Hour, got.Days[civil.Date{Year: 2023, Month: 03, Day: 25}])
+}
@@ -0,0 +1,88 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Switching tells how time spent on a day was split into stretches spent on the same categories.
+// Time between events does not interrupt a stretch, it just does not count towards it.
+type Switching struct {
+	// Switches is the number of times the categories of running events changed.
+	Switches int
+	// Stretches is the number of continuous stretches of time spent on the same categories.
+	Stretches int
+	// Time is the time spent in events.
+	Time time.Duration
+}
+
+// AverageStretch returns the average length of a stretch.
+func (s *Switching) AverageStretch() time.Duration {
+	if s.Stretches == 0 {
+		return 0
+	}
+	return s.Time / time.Duration(s.Stretches)
+}
+
+// Fragmentation returns the number of switches per hour of time spent.
+func (s *Switching) Fragmentation() float64 {
+	if s.Time == 0 {
+		return 0
+	}
+	return float64(s.Switches) / s.Time.Hours()
+}
+
+// Add adds the other switching to this one.
+func (s *Switching) Add(other *Switching) {
+	s.Switches += other.Switches
+	s.Stretches += other.Stretches
+	s.Time += other.Time
+}
+
+// SwitchingThresholds tell which days are especially choppy. Zero values are not checked.
+type SwitchingThresholds struct {
+	MaxSwitches       int
+	MinAverageStretch time.Duration
+	MaxFragmentation  float64
+}
+
+// Exceeded returns true if the switching exceeds any of the thresholds.
+func (t SwitchingThresholds) Exceeded(s *Switching) bool {
+	switch {
+	case t.MaxSwitches > 0 && s.Switches > t.MaxSwitches:
+		return true
+	case t.MinAverageStretch > 0 && s.Stretches > 0 && s.AverageStretch() < t.MinAverageStretch:
+		return true
+	case t.MaxFragmentation > 0 && s.Fragmentation() > t.MaxFragmentation:
+		return true
+	}
+	return false
+}
+
+// activity returns what is being done in the span, the names of categories of running events, sorted.
+func (s *span) activity() string {
+	var names []string
+	for _, name := range s.events {
+		if !slices.Contains(names, string(name)) {
+			names = append(names, string(name))
+		}
+	}
+	slices.Sort(names)
+	return strings.Join(names, "\n")
+}
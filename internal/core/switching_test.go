@@ -0,0 +1,55 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestComputeSwitching(t *testing.T) {
+	events := []*calendar.Event{
+		newEvent("2023-03-27T09:00:00Z", "2023-03-27T10:00:00Z", "mail"),
+		newEvent("2023-03-27T10:00:00Z", "2023-03-27T11:00:00Z", "meeting"),
+		newEvent("2023-03-27T11:00:00Z", "2023-03-27T11:30:00Z", "mail"),
+		newEvent("2023-03-27T12:00:00Z", "2023-03-27T12:30:00Z", "mail"),
+		newEvent("2023-03-27T12:15:00Z", "2023-03-27T13:00:00Z", "meeting"),
+		newEvent("2023-03-28T09:00:00Z", "2023-03-28T10:00:00Z", "mail"),
+	}
+	categories := []*Category{
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("mail")}},
+		{Name: "meetings", Patterns: []*regexp.Regexp{regexp.MustCompile("meeting")}},
+	}
+	totals := Compute(events, categories, Options{Location: time.UTC})
+	monday := totals.Switching[civil.Date{Year: 2023, Month: 3, Day: 27}]
+	assert.Equal(t, &Switching{Switches: 4, Stretches: 5, Time: 210 * time.Minute}, monday)
+	assert.Equal(t, 42*time.Minute, monday.AverageStretch())
+	assert.InDelta(t, 4/3.5, monday.Fragmentation(), 1e-9)
+	tuesday := totals.Switching[civil.Date{Year: 2023, Month: 3, Day: 28}]
+	assert.Equal(t, &Switching{Switches: 0, Stretches: 1, Time: time.Hour}, tuesday)
+
+	assert.True(t, SwitchingThresholds{MaxSwitches: 3}.Exceeded(monday))
+	assert.False(t, SwitchingThresholds{MaxSwitches: 4}.Exceeded(monday))
+	assert.True(t, SwitchingThresholds{MinAverageStretch: 45 * time.Minute}.Exceeded(monday))
+	assert.True(t, SwitchingThresholds{MaxFragmentation: 1}.Exceeded(monday))
+	assert.False(t, SwitchingThresholds{MaxSwitches: 3, MinAverageStretch: 45 * time.Minute, MaxFragmentation: 1}.Exceeded(tuesday))
+	assert.False(t, SwitchingThresholds{}.Exceeded(monday))
+}
@@ -0,0 +1,72 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	hashtag       = regexp.MustCompile(`(?:^|\s)#(\p{L}[\p{L}\p{N}_-]*)`)
+	bracketPrefix = regexp.MustCompile(`^\s*\[([^\[\]]+)\]`)
+)
+
+// InlineTags returns tags written in the text as #hashtags anywhere, or as [bracketed] words
+// at its beginning, as in "[ACME] sync #billable". Tags are lower-cased and returned once each,
+// in order of appearance.
+func InlineTags(text string) []string {
+	var ret []string
+	seen := make(map[string]bool)
+	add := func(tag string) {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			ret = append(ret, tag)
+		}
+	}
+	for rest := text; ; {
+		m := bracketPrefix.FindStringSubmatchIndex(rest)
+		if m == nil {
+			break
+		}
+		add(rest[m[2]:m[3]])
+		rest = rest[m[1]:]
+	}
+	for _, m := range hashtag.FindAllStringSubmatch(text, -1) {
+		add(m[1])
+	}
+	return ret
+}
+
+// InlineTagsField returns a Field with inline tags of events, found in the summary and,
+// if descriptions is true, also in the description.
+func InlineTagsField(descriptions bool) Field {
+	return func(e *calendar.Event) []string {
+		tags := InlineTags(e.Summary)
+		if descriptions {
+			for _, tag := range InlineTags(e.Description) {
+				if !slices.Contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+		}
+		return tags
+	}
+}
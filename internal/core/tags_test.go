@@ -0,0 +1,64 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestInlineTags(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"sync", nil},
+		{"[ACME] sync #billable #infra", []string{"acme", "billable", "infra"}},
+		{" [ACME][Ops] sync", []string{"acme", "ops"}},
+		{"sync [not a prefix]", nil},
+		{"#Billable, #billable and #infra-2", []string{"billable", "infra-2"}},
+		{"C# review, issue #123", nil},
+		{"[] #", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.want, InlineTags(tt.text))
+		})
+	}
+}
+
+func TestInlineTagsField(t *testing.T) {
+	event := &calendar.Event{Summary: "[ACME] sync", Description: "#billable #acme"}
+	assert.Equal(t, []string{"acme"}, InlineTagsField(false)(event))
+	assert.Equal(t, []string{"acme", "billable"}, InlineTagsField(true)(event))
+}
+
+func TestComputeInlineTags(t *testing.T) {
+	events := []*calendar.Event{
+		newEvent("2023-03-27T09:00:00Z", "2023-03-27T10:00:00Z", "[ACME] sync #billable"),
+		newEvent("2023-03-27T09:30:00Z", "2023-03-27T10:30:00Z", "#infra review"),
+		newEvent("2023-03-27T11:00:00Z", "2023-03-27T12:00:00Z", "lunch"),
+	}
+	totals := Compute(events, nil, Options{Location: time.UTC})
+	assert.Equal(t, map[string]time.Duration{
+		"acme":     45 * time.Minute,
+		"billable": 45 * time.Minute,
+		"infra":    45 * time.Minute,
+	}, totals.Tags)
+}
@@ -49,6 +49,31 @@ func (t *timeline) sortedMoments() []time.Time {
 	return ordererd.KeysOfMap(t.moments, func(s []time.Time, i, j int) bool { return s[i].Before(s[j]) })
 }
 
+// busy returns the stretches of time in which any event runs, in chronological order.
+func (t *timeline) busy() []Block {
+	var ret []Block
+	var start time.Time
+	running := 0
+	for _, moment := range t.sortedMoments() {
+		wasRunning := running > 0
+		for _, thing := range t.thingsAt(moment) {
+			switch thing.what {
+			case eventStart:
+				running++
+			case eventEnd:
+				running--
+			}
+		}
+		switch {
+		case !wasRunning && running > 0:
+			start = moment
+		case wasRunning && running == 0:
+			ret = append(ret, Block{Start: start, End: moment})
+		}
+	}
+	return ret
+}
+
 func (t *timeline) thingsAt(moment time.Time) []thing {
 	return t.moments[moment]
 }
@@ -17,7 +17,6 @@ package core
 
 import (
 	"fmt"
-	"log"
 	"time"
 
 	"cloud.google.com/go/civil"
@@ -38,19 +37,103 @@ type thing struct {
 	newDay *civil.Date
 }
 
+// Options control how time spent in events is accounted for.
+type Options struct {
+	// Location determines where days begin and end.
+	Location *time.Location
+	// Start and End, if not zero, limit accounting to this time range.
+	// Events which cross its boundaries only count with the part inside it.
+	Start, End time.Time
+	// Stretch lists rules for changing the duration of events, the first matching one applies.
+	Stretch []StretchRule
+	// Dimensions are ways of tagging events, which are accounted for separately from categories.
+	Dimensions []*Dimension
+	// DescriptionTags makes inline tags be looked for in event descriptions, not only summaries.
+	DescriptionTags bool
+	// Policy decides which events are counted at all.
+	Policy Policy
+	// AllDay, if not nil, counts all-day events and out of office entries as a fixed time per working day.
+	AllDay *AllDayRule
+	// WorkingDays are the days of the week on which people work, DefaultWorkingDays if empty.
+	// It is ignored if there is a Schedule.
+	WorkingDays []time.Weekday
+	// Schedule, if not nil, is used to compute expected working time and free time.
+	Schedule *Schedule
+	// FocusBlock is the shortest stretch of free working time which counts as a focus window.
+	FocusBlock time.Duration
+	// InternalDomains are email domains of your organization. If empty, the domain of your own address is used.
+	InternalDomains []string
+}
+
+// Totals are the results of accounting for time spent in events.
+type Totals struct {
+	// Days maps civil dates to time spent on them.
+	Days map[civil.Date]time.Duration
+	// Categories maps category names to time spent on them.
+	Categories map[CategoryName]time.Duration
+	// Subtrees maps category names to time spent on them and their descendants.
+	// Unlike Categories, it includes parent categories which have no rules of their own.
+	Subtrees map[CategoryName]time.Duration
+	// DayCategories maps civil dates to time spent on each category on that date.
+	// It adds up to Days per date and to Categories per category, up to rounding.
+	DayCategories map[civil.Date]map[CategoryName]time.Duration
+	// Dimensions maps names of dimensions to time spent per tag in each.
+	Dimensions map[string]map[CategoryName]time.Duration
+	// Tags maps inline tags to time spent in events which have them.
+	// An event with several tags counts towards each of them.
+	Tags map[string]time.Duration
+	// Unrecognized lists events which do not belong to any category.
+	Unrecognized []*calendar.Event
+	// Expected maps civil dates to working time expected on them, according to Options.Schedule.
+	// Days without working hours are omitted.
+	Expected map[civil.Date]time.Duration
+	// WithinHours maps civil dates to the part of time spent on them, which falls within working hours.
+	// Time counted by the all-day rule is considered within working hours.
+	WithinHours map[civil.Date]time.Duration
+	// Meetings is the time spent in events split by who else attended them.
+	Meetings *Meetings
+	// Series maps IDs of recurring events to time spent in their instances.
+	Series map[string]*Series
+	// Switching maps civil dates to how often the categories of running events changed on them.
+	Switching map[civil.Date]*Switching
+	// Free lists stretches of working hours in which no event was counted, in chronological order.
+	// Time covered by events counted by the all-day rule is not free either. It is only computed with a Schedule.
+	Free []Block
+}
+
+// Compute accounts for time spent in events, splitting it between categories.
+func Compute(events []*calendar.Event, categories []*Category, opts Options) *Totals {
+	moments := computeTimeline(events, categories, opts)
+	totals := categorizeTime(moments, categories, opts)
+	daysOff := countAllDay(totals, events, opts)
+	countDeclined(totals, events, opts)
+	if opts.Schedule != nil {
+		expect(totals, opts)
+		findFree(totals, opts, append(moments.busy(), daysOff...))
+	}
+	totals.Subtrees = RollUp(totals.Categories)
+	return totals
+}
+
+// ComputeTotals is a shortcut for Compute with no time range limit and default stretching rules.
 func ComputeTotals(events []*calendar.Event, categories []*Category, location *time.Location) (map[civil.Date]time.Duration, map[CategoryName]time.Duration, []*calendar.Event) {
-	moments := computeTimeline(events, location)
-	return categorizeTime(moments, categories)
+	totals := Compute(events, categories, Options{Location: location, Stretch: DefaultStretchRules})
+	return totals.Days, totals.Categories, totals.Unrecognized
 }
 
-func computeTimeline(events []*calendar.Event, currentLocation *time.Location) *timeline {
-	t := newTimeline(currentLocation)
+func computeTimeline(events []*calendar.Event, categories []*Category, opts Options) *timeline {
+	t := newTimeline(opts.Location)
 
 	for _, event := range events {
-		isAccepted, evStart, evEnd := parseEvent(event)
+		isAccepted, evStart, evEnd := parseEvent(event, opts.Policy)
 		if !isAccepted {
 			continue
 		}
+		evStart, evEnd = stretch(opts.Stretch, categories, event, evStart, evEnd)
+		evStart, evEnd, isInside := clip(evStart, evEnd, opts.Start, opts.End)
+		if !isInside {
+			continue
+		}
 		t.addEvent(event, evStart, evEnd)
 
 		for _, boundary := range []time.Time{evStart, evEnd} {
@@ -62,8 +145,8 @@ func computeTimeline(events []*calendar.Event, currentLocation *time.Location) *
 	return t
 }
 
-func parseEvent(event *calendar.Event) (bool, time.Time, time.Time) {
-	if !shouldConsider(event) {
+func parseEvent(event *calendar.Event, policy Policy) (bool, time.Time, time.Time) {
+	if !shouldConsider(event, policy) {
 		return false, time.Time{}, time.Time{}
 	}
 	evStart, err := time.Parse(time.RFC3339, event.Start.DateTime)
@@ -77,64 +160,55 @@ func parseEvent(event *calendar.Event) (bool, time.Time, time.Time) {
 		fmt.Printf("Failed to parse end time [%s] of event %v\n", event.End.DateTime, event.Summary)
 		return false, time.Time{}, time.Time{}
 	}
-	evStart, evEnd = stretchSpeedyMeetings(evStart, evEnd)
 	return true, evStart, evEnd
 }
 
-func shouldConsider(event *calendar.Event) bool {
-	if event.Start.DateTime == "" {
-		// full-day event
-		return false
-	}
-	if event.EventType == "outOfOffice" || event.EventType == "workingLocation" {
-		return false
-	}
-	for _, attendee := range event.Attendees {
-		if attendee.Self && attendee.ResponseStatus == "declined" {
-			return false
+// clip returns the part of event time which falls within the given range,
+// and false if there is no such part. Zero start or end means no limit.
+func clip(evStart, evEnd, start, end time.Time) (time.Time, time.Time, bool) {
+	if !start.IsZero() {
+		if evEnd.Before(start) || (evEnd.Equal(start) && evStart.Before(start)) {
+			return evStart, evEnd, false
 		}
-	}
-	if event.Organizer != nil && event.Organizer.Self {
-		return true
-	}
-	if event.Creator != nil && event.Creator.Self {
-		return true
-	}
-	for _, attendee := range event.Attendees {
-		if attendee.Self {
-			return attendee.ResponseStatus == "accepted"
+		if evStart.Before(start) {
+			evStart = start
 		}
 	}
-	log.Printf("self not found among attendees of %+v %+v", event.Organizer, event.Creator)
-	return false
-}
-
-// stretchSpeedyMeetings delays endTime if needed.
-// Speedy meetings are a lie. They usually last until the full half hour anyway.
-func stretchSpeedyMeetings(evStart, evEnd time.Time) (time.Time, time.Time) {
-	d := evEnd.Sub(evStart)
-	if d == 50*time.Minute {
-		return evStart, evStart.Add(1 * time.Hour)
-	} else if d == 40*time.Minute {
-		return evStart, evStart.Add(45 * time.Minute)
-	} else if d == 25*time.Minute {
-		return evStart, evStart.Add(30 * time.Minute)
-	} else {
-		return evStart, evEnd
+	if !end.IsZero() {
+		if !evStart.Before(end) {
+			return evStart, evEnd, false
+		}
+		if evEnd.After(end) {
+			evEnd = end
+		}
 	}
+	return evStart, evEnd, true
 }
 
-// categorizeTime returns three values. A map from civil date to time spent on it,
-// a map from category name to time spent on it, and a slice of unrecognized calendar events.
-func categorizeTime(t *timeline, categories []*Category) (map[civil.Date]time.Duration, map[CategoryName]time.Duration, []*calendar.Event) {
+// categorizeTime returns the time spent per civil date, per category, per both and per (inline) tag,
+// and the unrecognized calendar events.
+func categorizeTime(t *timeline, categories []*Category, opts Options) *Totals {
 	momentTimes := t.sortedMoments()
-	dayTotals := make(map[civil.Date]time.Duration)
-	categoryTotals := make(map[CategoryName]time.Duration)
-	unrecognized := []*calendar.Event{}
-	currentTasks := newSpan(categories)
+	totals := &Totals{
+		Days:          make(map[civil.Date]time.Duration),
+		Categories:    make(map[CategoryName]time.Duration),
+		DayCategories: make(map[civil.Date]map[CategoryName]time.Duration),
+		Dimensions:    make(map[string]map[CategoryName]time.Duration),
+		Tags:          make(map[string]time.Duration),
+		Unrecognized:  []*calendar.Event{},
+		Expected:      make(map[civil.Date]time.Duration),
+		WithinHours:   make(map[civil.Date]time.Duration),
+		Switching:     make(map[civil.Date]*Switching),
+		Meetings:      newMeetings(),
+		Series:        make(map[string]*Series),
+	}
+	for _, d := range opts.Dimensions {
+		totals.Dimensions[d.Name] = make(map[CategoryName]time.Duration)
+	}
+	currentTasks := newSpan(categories, opts)
 
 	for _, momentTime := range momentTimes {
-		currentTasks.checkpoint(dayTotals, categoryTotals, momentTime)
+		currentTasks.checkpoint(totals, momentTime)
 		for _, thing := range t.thingsAt(momentTime) {
 			switch thing.what {
 			case midnight:
@@ -142,11 +216,14 @@ func categorizeTime(t *timeline, categories []*Category) (map[civil.Date]time.Du
 			case eventEnd:
 				currentTasks.eventEnd(thing.event)
 			case eventStart:
+				if series := totals.series(thing.event); series != nil {
+					series.Attended++
+				}
 				if ok := currentTasks.eventStart(thing.event); !ok {
-					unrecognized = append(unrecognized, thing.event)
+					totals.Unrecognized = append(totals.Unrecognized, thing.event)
 				}
 			}
 		}
 	}
-	return dayTotals, categoryTotals, unrecognized
+	return totals
 }
@@ -16,12 +16,15 @@
 package core
 
 import (
+	"context"
 	"regexp"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/civil"
+	"github.com/porridge/calendar-stats/internal/source"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/api/calendar/v3"
 )
 
@@ -153,6 +156,107 @@ func TestComputeTotals(t *testing.T) {
 	}
 }
 
+func TestComputeClipsToTimeRange(t *testing.T) {
+	events := []*calendar.Event{
+		// on-call shift from Sunday evening to Monday morning
+		newEvent("2023-03-26T20:00:00+00:00", "2023-03-27T08:00:00+00:00", "on-call"),
+		// entirely before the range
+		newEvent("2023-03-26T10:00:00+00:00", "2023-03-26T11:00:00+00:00", "on-call"),
+		// ends exactly when the range starts
+		newEvent("2023-03-26T23:00:00+00:00", "2023-03-27T00:00:00+00:00", "on-call"),
+		newEvent("2023-03-27T10:00:00+00:00", "2023-03-27T11:00:00+00:00", "mail"),
+		// crosses the end of the range
+		newEvent("2023-03-27T11:30:00+00:00", "2023-03-27T12:30:00+00:00", "mail"),
+		// starts exactly when the range ends
+		newEvent("2023-03-27T12:00:00+00:00", "2023-03-27T12:30:00+00:00", "mail"),
+	}
+	categories := []*Category{
+		{Name: "oncall", Patterns: []*regexp.Regexp{regexp.MustCompile("on-call")}},
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("mail")}},
+	}
+	got := Compute(events, categories, Options{
+		Location: time.UTC,
+		Start:    time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 3, 27, 12, 0, 0, 0, time.UTC),
+	})
+	assert.Equal(t, map[civil.Date]time.Duration{
+		{Year: 2023, Month: 03, Day: 27}: 9*time.Hour + 30*time.Minute,
+	}, got.Days)
+	assert.Equal(t, map[CategoryName]time.Duration{
+		"oncall": 8 * time.Hour,
+		"mail":   90 * time.Minute,
+	}, got.Categories)
+}
+
+func TestComputeTotalsFromFixture(t *testing.T) {
+	src, err := source.ParseFixture(`
+- start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T09:30:00Z
+  summary: read mail
+- start: 2023-03-27T09:15:00Z
+  end: 2023-03-27T10:05:00Z
+  summary: team meeting
+  response: accepted
+- start: 2023-03-27T11:00:00Z
+  end: 2023-03-27T12:00:00Z
+  summary: another meeting
+  response: declined
+- date: 2023-03-28
+  summary: conference
+- start: 2023-03-28T08:00:00Z
+  end: 2023-03-28T09:00:00Z
+  summary: out
+  type: outOfOffice
+`)
+	require.NoError(t, err)
+	events, err := src.List(context.Background(), time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC), time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	gotTotals, gotCategories, gotUnrecognized := ComputeTotals(events, []*Category{
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("mail")}},
+	}, time.UTC)
+	assert.Equal(t, map[civil.Date]time.Duration{
+		{Year: 2023, Month: 03, Day: 27}: 75 * time.Minute,
+	}, gotTotals)
+	assert.Equal(t, map[CategoryName]time.Duration{
+		"mail":        22*time.Minute + 30*time.Second,
+		Uncategorized: 52*time.Minute + 30*time.Second,
+	}, gotCategories)
+	require.Len(t, gotUnrecognized, 1)
+	assert.Equal(t, "team meeting", gotUnrecognized[0].Summary)
+}
+
+func TestComputeDayCategories(t *testing.T) {
+	events := []*calendar.Event{
+		newEvent("2023-03-27T09:00:00Z", "2023-03-27T10:00:00Z", "read mail"),
+		newEvent("2023-03-27T09:30:00Z", "2023-03-27T10:30:00Z", "meeting"),
+		newEvent("2023-03-27T23:00:00Z", "2023-03-28T01:00:00Z", "late meeting"),
+		newEvent("2023-03-28T12:00:00Z", "2023-03-28T12:30:00Z", "lunch"),
+	}
+	categories := []*Category{
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("mail")}},
+		{Name: "meetings", Patterns: []*regexp.Regexp{regexp.MustCompile("meeting")}},
+	}
+	totals := Compute(events, categories, Options{Location: time.UTC})
+	assert.Equal(t, map[civil.Date]map[CategoryName]time.Duration{
+		{Year: 2023, Month: 3, Day: 27}: {
+			"mail":     45 * time.Minute,
+			"meetings": 45*time.Minute + time.Hour,
+		},
+		{Year: 2023, Month: 3, Day: 28}: {
+			"meetings":    time.Hour,
+			Uncategorized: 30 * time.Minute,
+		},
+	}, totals.DayCategories)
+	for day, byCategory := range totals.DayCategories {
+		var sum time.Duration
+		for _, d := range byCategory {
+			sum += d
+		}
+		assert.Equal(t, totals.Days[day], sum, day)
+	}
+}
+
 func newEvent(startTime string, endTime string, title ...string) *calendar.Event {
 	e := &calendar.Event{
 		Organizer: &calendar.EventOrganizer{Self: true},
@@ -168,3 +272,67 @@ func newEvent(startTime string, endTime string, title ...string) *calendar.Event
 	}
 	return e
 }
+
+func TestRollUp(t *testing.T) {
+	assert.Equal(t, map[CategoryName]time.Duration{
+		"engineering":                4 * time.Hour,
+		"engineering/reviews":        3 * time.Hour,
+		"engineering/reviews/design": time.Hour,
+		"engineering/oncall":         time.Hour,
+		"mail":                       time.Hour,
+		Uncategorized:                time.Hour,
+	}, RollUp(map[CategoryName]time.Duration{
+		"engineering/reviews":        2 * time.Hour,
+		"engineering/reviews/design": time.Hour,
+		"engineering/oncall":         time.Hour,
+		"mail":                       time.Hour,
+		Uncategorized:                time.Hour,
+	}))
+}
+
+func TestCategoryName(t *testing.T) {
+	name := CategoryName("engineering/reviews/design")
+	assert.Equal(t, CategoryName("engineering/reviews"), name.Parent())
+	assert.Equal(t, "design", name.Base())
+	assert.Equal(t, 2, name.Depth())
+	assert.True(t, name.Within("engineering"))
+	assert.True(t, name.Within(name))
+	assert.False(t, name.Within("engineering/rev"))
+	assert.Equal(t, Uncategorized, CategoryName("mail").Parent())
+}
+
+func TestComputeDimensions(t *testing.T) {
+	events := []*calendar.Event{
+		newEvent("2023-03-27T09:00:00Z", "2023-03-27T10:00:00Z", "[acme] sync"),
+		newEvent("2023-03-27T09:30:00Z", "2023-03-27T10:30:00Z", "[acme] code review"),
+		newEvent("2023-03-27T11:00:00Z", "2023-03-27T12:00:00Z", "[internal] planning"),
+		newEvent("2023-03-27T12:00:00Z", "2023-03-27T12:30:00Z", "lunch"),
+	}
+	pattern := func(re string) []*regexp.Regexp { return []*regexp.Regexp{regexp.MustCompile(re)} }
+	totals := Compute(events, []*Category{
+		{Name: "meetings", Patterns: pattern("sync|planning")},
+	}, Options{
+		Location: time.UTC,
+		Dimensions: []*Dimension{
+			{Name: "project", Tags: []*Category{
+				{Name: "acme", Patterns: pattern(`^\[acme\]`)},
+				{Name: "internal", Patterns: pattern(`^\[internal\]`)},
+			}},
+			{Name: "activity", Tags: []*Category{
+				{Name: "review", Patterns: pattern("review")},
+			}},
+		},
+	})
+	assert.Equal(t, map[string]map[CategoryName]time.Duration{
+		"project": {
+			"acme":     90 * time.Minute,
+			"internal": time.Hour,
+			Untagged:   30 * time.Minute,
+		},
+		"activity": {
+			"review": 45 * time.Minute,
+			Untagged: 45*time.Minute + time.Hour + 30*time.Minute,
+		},
+	}, totals.Dimensions)
+	assert.Equal(t, 105*time.Minute, totals.Categories["meetings"])
+}
@@ -0,0 +1,77 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package flags
+
+import (
+	"flag"
+	"strings"
+)
+
+// ListValue returns a flag which may be repeated, or set to a comma-separated list.
+// The first use of the flag replaces any default values in the slice.
+func ListValue(l *[]string) flag.Value {
+	return &listValue{list: l}
+}
+
+type listValue struct {
+	list *[]string
+	set  bool
+}
+
+func (v *listValue) String() string {
+	if v.list == nil {
+		return ""
+	}
+	return strings.Join(*v.list, ",")
+}
+
+func (v *listValue) Set(str string) error {
+	if !v.set {
+		*v.list = nil
+		v.set = true
+	}
+	for _, e := range strings.Split(str, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			*v.list = append(*v.list, e)
+		}
+	}
+	return nil
+}
+
+// PrefixValue returns a value which sets v to each of the comma-separated elements it is set to, with prefix added.
+func PrefixValue(v flag.Value, prefix string) flag.Value {
+	return &prefixValue{v, prefix}
+}
+
+type prefixValue struct {
+	flag.Value
+	prefix string
+}
+
+func (v *prefixValue) String() string {
+	return ""
+}
+
+func (v *prefixValue) Set(str string) error {
+	for _, e := range strings.Split(str, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			if err := v.Value.Set(v.prefix + e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
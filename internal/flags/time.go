@@ -31,7 +31,7 @@ type timeValue struct {
 }
 
 func (v timeValue) String() string {
-	if v.Time == nil {
+	if v.Time == nil || v.Time.IsZero() {
 		return ""
 	}
 	return v.Time.Format(time.RFC3339)
@@ -0,0 +1,377 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package ics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/ordererd"
+	"google.golang.org/api/calendar/v3"
+)
+
+// maxInstances bounds the number of occurrences of a never-ending series when no End is given.
+const maxInstances = 1000
+
+// Options control how events are read.
+type Options struct {
+	// Start and End, if non-zero, limit the returned events to those which overlap this time range.
+	Start, End time.Time
+	// Location is used for floating times, dates and unknown time zones.
+	Location *time.Location
+	// Self lists email addresses of the calendar owner, used to find their attendance status.
+	// If the calendar name (X-WR-CALNAME) looks like an email address, it is used as well.
+	Self []string
+}
+
+// Read returns the events from an iCalendar stream, with recurring events
+// expanded into single instances, the way Google Calendar API returns them
+// when asked for single events. Events which cannot be understood, such as
+// ones with unsupported recurrence rules, are skipped with a warning.
+func Read(r io.Reader, opts Options) ([]*calendar.Event, error) {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	top, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	var events []*calendar.Event
+	for _, cal := range top {
+		if cal.name != "VCALENDAR" {
+			continue
+		}
+		c := newConverter(cal, opts)
+		calEvents, err := c.convert()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, calEvents...)
+	}
+	return events, nil
+}
+
+type converter struct {
+	cal   *component
+	opts  Options
+	zones *zones
+	self  map[string]bool
+}
+
+func newConverter(cal *component, opts Options) *converter {
+	c := &converter{cal: cal, opts: opts, zones: newZones(opts.Location), self: make(map[string]bool)}
+	for _, vtimezone := range cal.components {
+		if vtimezone.name == "VTIMEZONE" {
+			c.zones.define(vtimezone)
+		}
+	}
+	for _, email := range opts.Self {
+		c.self[strings.ToLower(email)] = true
+	}
+	if name := cal.text("X-WR-CALNAME"); strings.Contains(name, "@") {
+		c.self[strings.ToLower(name)] = true
+	}
+	return c
+}
+
+// occurrence is a single instance of a (possibly recurring) VEVENT.
+type occurrence struct {
+	vevent        *component
+	start, end    time.Time
+	allDay        bool
+	originalStart time.Time // zero for non-recurring events
+}
+
+func (c *converter) convert() ([]*calendar.Event, error) {
+	var masters []*component
+	overrides := make(map[string]map[int64]*component)
+	for _, vevent := range c.cal.components {
+		if vevent.name != "VEVENT" {
+			continue
+		}
+		rid := vevent.prop("RECURRENCE-ID")
+		if rid == nil {
+			masters = append(masters, vevent)
+			continue
+		}
+		times, _, err := c.zones.parseTimes(rid)
+		if err != nil {
+			return nil, fmt.Errorf("event %q: %w", vevent.text("UID"), err)
+		}
+		uid := vevent.text("UID")
+		if overrides[uid] == nil {
+			overrides[uid] = make(map[int64]*component)
+		}
+		overrides[uid][times[0].Unix()] = vevent
+	}
+
+	var events []*calendar.Event
+	for _, master := range masters {
+		uid := master.text("UID")
+		occurrences, err := c.expand(master, overrides[uid])
+		if err != nil {
+			// One series this reader cannot understand should not make the rest of the calendar unreadable.
+			log.Printf("Skipping event %q (%s): %s", master.text("SUMMARY"), uid, err)
+			delete(overrides, uid)
+			continue
+		}
+		for _, o := range occurrences {
+			if c.wanted(o) {
+				events = append(events, c.event(o))
+			}
+		}
+	}
+	// Overrides of instances that were not generated, e.g. moved in from beyond the expansion limit.
+	for _, uid := range ordererd.KeysOfMap(overrides, func(s []string, i, j int) bool { return s[i] < s[j] }) {
+		byStart := overrides[uid]
+		for _, original := range ordererd.KeysOfMap(byStart, func(s []int64, i, j int) bool { return s[i] < s[j] }) {
+			vevent := byStart[original]
+			o, err := c.times(vevent)
+			if err != nil {
+				log.Printf("Skipping event %q (%s): %s", vevent.text("SUMMARY"), uid, err)
+				continue
+			}
+			o.originalStart = time.Unix(original, 0)
+			if c.wanted(o) {
+				events = append(events, c.event(o))
+			}
+		}
+	}
+	return events, nil
+}
+
+// times returns the single occurrence described by the DTSTART, DTEND and DURATION of vevent.
+func (c *converter) times(vevent *component) (*occurrence, error) {
+	dtstart := vevent.prop("DTSTART")
+	if dtstart == nil {
+		return nil, fmt.Errorf("missing DTSTART")
+	}
+	starts, allDay, err := c.zones.parseTimes(dtstart)
+	if err != nil {
+		return nil, err
+	}
+	o := &occurrence{vevent: vevent, start: starts[0], allDay: allDay}
+	if dtend := vevent.prop("DTEND"); dtend != nil {
+		ends, _, err := c.zones.parseTimes(dtend)
+		if err != nil {
+			return nil, err
+		}
+		o.end = ends[0]
+	} else if duration := vevent.prop("DURATION"); duration != nil {
+		d, err := parseDuration(duration.value)
+		if err != nil {
+			return nil, err
+		}
+		o.end = addDuration(o.start, d, allDay)
+	} else if allDay {
+		o.end = o.start.AddDate(0, 0, 1)
+	} else {
+		o.end = o.start
+	}
+	return o, nil
+}
+
+// expand returns all occurrences of a master VEVENT, applying EXDATE, RDATE and overrides.
+func (c *converter) expand(master *component, overrides map[int64]*component) ([]*occurrence, error) {
+	first, err := c.times(master)
+	if err != nil {
+		return nil, err
+	}
+	rruleProp := master.prop("RRULE")
+	rdates := master.propsNamed("RDATE")
+	if rruleProp == nil && len(rdates) == 0 {
+		return []*occurrence{first}, nil
+	}
+
+	limit := c.opts.End
+	var starts []time.Time
+	if rruleProp != nil {
+		rule, err := parseRRule(rruleProp.value, c.zones)
+		if err != nil {
+			return nil, err
+		}
+		if limit.IsZero() && rule.count == 0 && rule.until.IsZero() {
+			rule.count = maxInstances
+		}
+		if limit.IsZero() {
+			limit = time.Unix(1<<62, 0)
+		}
+		starts = rule.expand(first.start, limit)
+	} else {
+		starts = []time.Time{first.start}
+	}
+	for _, p := range rdates {
+		if p.param("VALUE") == "PERIOD" {
+			log.Printf("Ignoring unsupported RDATE period value %q", p.value)
+			continue
+		}
+		times, _, err := c.zones.parseTimes(p)
+		if err != nil {
+			return nil, err
+		}
+		starts = append(starts, times...)
+	}
+
+	excluded := make(map[int64]bool)
+	for _, p := range master.propsNamed("EXDATE") {
+		times, _, err := c.zones.parseTimes(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range times {
+			excluded[t.Unix()] = true
+		}
+	}
+
+	length := first.end.Sub(first.start)
+	seen := make(map[int64]bool)
+	var ret []*occurrence
+	for _, start := range starts {
+		key := start.Unix()
+		if excluded[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if override, ok := overrides[key]; ok {
+			delete(overrides, key)
+			o, err := c.times(override)
+			if err != nil {
+				return nil, err
+			}
+			o.originalStart = start
+			ret = append(ret, o)
+			continue
+		}
+		ret = append(ret, &occurrence{
+			vevent:        master,
+			start:         start,
+			end:           addDuration(start, length, first.allDay),
+			allDay:        first.allDay,
+			originalStart: start,
+		})
+	}
+	return ret, nil
+}
+
+// addDuration adds d to t, rounded to calendar days for all-day events,
+// so that they keep starting at midnight across DST changes.
+func addDuration(t time.Time, d time.Duration, allDay bool) time.Time {
+	if allDay {
+		return t.AddDate(0, 0, int((d+12*time.Hour)/(24*time.Hour)))
+	}
+	return t.Add(d)
+}
+
+// wanted returns true if the occurrence is not cancelled and overlaps the requested time range.
+func (c *converter) wanted(o *occurrence) bool {
+	if strings.EqualFold(o.vevent.text("STATUS"), "CANCELLED") {
+		return false
+	}
+	if !c.opts.End.IsZero() && !o.start.Before(c.opts.End) {
+		return false
+	}
+	if !c.opts.Start.IsZero() && !o.end.After(c.opts.Start) {
+		return false
+	}
+	return true
+}
+
+var partStats = map[string]string{
+	"ACCEPTED":     "accepted",
+	"DECLINED":     "declined",
+	"TENTATIVE":    "tentative",
+	"NEEDS-ACTION": "needsAction",
+}
+
+// event converts an occurrence into the event model used by Google Calendar API.
+func (c *converter) event(o *occurrence) *calendar.Event {
+	vevent := o.vevent
+	uid := vevent.text("UID")
+	e := &calendar.Event{
+		Id:          uid,
+		ICalUID:     uid,
+		Summary:     vevent.text("SUMMARY"),
+		Description: vevent.text("DESCRIPTION"),
+		Location:    vevent.text("LOCATION"),
+		Status:      strings.ToLower(vevent.text("STATUS")),
+		EventType:   "default",
+		Start:       c.dateTime(o.start, o.allDay, vevent.prop("DTSTART")),
+		End:         c.dateTime(o.end, o.allDay, vevent.prop("DTSTART")),
+	}
+	if e.Status == "" {
+		e.Status = "confirmed"
+	}
+	if strings.EqualFold(vevent.text("TRANSP"), "TRANSPARENT") {
+		e.Transparency = "transparent"
+	}
+	if strings.EqualFold(vevent.text("X-MICROSOFT-CDO-BUSYSTATUS"), "OOF") {
+		e.EventType = "outOfOffice"
+	}
+	if !o.originalStart.IsZero() {
+		e.Id = uid + "_" + o.originalStart.UTC().Format(dateTimeFormat) + "Z"
+		e.RecurringEventId = uid
+		e.OriginalStartTime = c.dateTime(o.originalStart, o.allDay, vevent.prop("DTSTART"))
+	}
+
+	for _, p := range vevent.propsNamed("ATTENDEE") {
+		email := mailAddress(p.value)
+		status, ok := partStats[strings.ToUpper(p.param("PARTSTAT"))]
+		if !ok {
+			status = "needsAction"
+		}
+		cuType := strings.ToUpper(p.param("CUTYPE"))
+		e.Attendees = append(e.Attendees, &calendar.EventAttendee{
+			Email:          email,
+			DisplayName:    p.param("CN"),
+			ResponseStatus: status,
+			Optional:       strings.EqualFold(p.param("ROLE"), "OPT-PARTICIPANT"),
+			Resource:       cuType == "RESOURCE" || cuType == "ROOM",
+			Self:           c.self[strings.ToLower(email)],
+		})
+	}
+	// An event nobody was invited to is the calendar owner's own.
+	e.Organizer = &calendar.EventOrganizer{Self: len(e.Attendees) == 0}
+	if p := vevent.prop("ORGANIZER"); p != nil {
+		e.Organizer.Email = mailAddress(p.value)
+		e.Organizer.DisplayName = p.param("CN")
+		e.Organizer.Self = e.Organizer.Self || c.self[strings.ToLower(e.Organizer.Email)]
+	}
+	for _, a := range e.Attendees {
+		a.Organizer = a.Email != "" && strings.EqualFold(a.Email, e.Organizer.Email)
+	}
+	return e
+}
+
+func (c *converter) dateTime(t time.Time, allDay bool, dtstart *property) *calendar.EventDateTime {
+	if allDay {
+		return &calendar.EventDateTime{Date: t.Format("2006-01-02")}
+	}
+	dt := &calendar.EventDateTime{DateTime: t.Format(time.RFC3339)}
+	if dtstart != nil {
+		dt.TimeZone = strings.TrimPrefix(dtstart.param("TZID"), "/")
+	}
+	return dt
+}
+
+func mailAddress(v string) string {
+	if len(v) >= len("mailto:") && strings.EqualFold(v[:len("mailto:")], "mailto:") {
+		return v[len("mailto:"):]
+	}
+	return v
+}
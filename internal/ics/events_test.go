@@ -0,0 +1,322 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package ics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const calendarHeader = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n"
+const calendarFooter = "END:VCALENDAR\r\n"
+
+func readEvents(t *testing.T, body string, opts Options) []string {
+	t.Helper()
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	events, err := Read(strings.NewReader(calendarHeader+body+calendarFooter), opts)
+	require.NoError(t, err)
+	var got []string
+	for _, e := range events {
+		start, end := e.Start.DateTime, e.End.DateTime
+		if e.Start.Date != "" {
+			start, end = e.Start.Date, e.End.Date
+		}
+		got = append(got, start+" "+end+" "+e.Summary)
+	}
+	return got
+}
+
+func TestReadSingleEvents(t *testing.T) {
+	got := readEvents(t, `BEGIN:VEVENT
+UID:1
+DTSTART:20230325T130000Z
+DTEND:20230325T133000Z
+SUMMARY:read mail\, quickly
+END:VEVENT
+BEGIN:VEVENT
+UID:2
+DTSTART;TZID=Europe/Warsaw:20230325T150000
+DURATION:PT45M
+SUMMARY:a very long summary which was
+  folded
+END:VEVENT
+BEGIN:VEVENT
+UID:3
+DTSTART;VALUE=DATE:20230326
+SUMMARY:holiday
+END:VEVENT
+BEGIN:VEVENT
+UID:4
+DTSTART:20230325T100000Z
+DTEND:20230325T110000Z
+STATUS:CANCELLED
+SUMMARY:cancelled
+END:VEVENT
+`, Options{})
+	assert.Equal(t, []string{
+		"2023-03-25T13:00:00Z 2023-03-25T13:30:00Z read mail, quickly",
+		"2023-03-25T15:00:00+01:00 2023-03-25T15:45:00+01:00 a very long summary which was folded",
+		"2023-03-26 2023-03-27 holiday",
+	}, got)
+}
+
+func TestReadRecurringEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		opts Options
+		want []string
+	}{
+		{
+			name: "weekly with exdate and override",
+			body: `BEGIN:VEVENT
+UID:standup
+DTSTART:20230306T090000Z
+DTEND:20230306T091500Z
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6
+EXDATE:20230308T090000Z
+SUMMARY:standup
+END:VEVENT
+BEGIN:VEVENT
+UID:standup
+RECURRENCE-ID:20230313T090000Z
+DTSTART:20230313T100000Z
+DTEND:20230313T103000Z
+SUMMARY:standup moved
+END:VEVENT
+`,
+			want: []string{
+				"2023-03-06T09:00:00Z 2023-03-06T09:15:00Z standup",
+				"2023-03-13T10:00:00Z 2023-03-13T10:30:00Z standup moved",
+				"2023-03-15T09:00:00Z 2023-03-15T09:15:00Z standup",
+				"2023-03-20T09:00:00Z 2023-03-20T09:15:00Z standup",
+				"2023-03-22T09:00:00Z 2023-03-22T09:15:00Z standup",
+			},
+		},
+		{
+			name: "monthly on last friday limited by window",
+			body: `BEGIN:VEVENT
+UID:retro
+DTSTART:20230127T140000Z
+DTEND:20230127T150000Z
+RRULE:FREQ=MONTHLY;BYDAY=-1FR
+SUMMARY:retro
+END:VEVENT
+`,
+			opts: Options{
+				Start: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+				End:   time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC),
+			},
+			want: []string{
+				"2023-03-31T14:00:00Z 2023-03-31T15:00:00Z retro",
+				"2023-04-28T14:00:00Z 2023-04-28T15:00:00Z retro",
+			},
+		},
+		{
+			name: "daily across DST keeps wall clock time",
+			body: `BEGIN:VEVENT
+UID:lunch
+DTSTART;TZID=Europe/Warsaw:20230324T120000
+DTEND;TZID=Europe/Warsaw:20230324T130000
+RRULE:FREQ=DAILY;INTERVAL=2;UNTIL=20230328T235959Z
+SUMMARY:lunch
+END:VEVENT
+`,
+			want: []string{
+				"2023-03-24T12:00:00+01:00 2023-03-24T13:00:00+01:00 lunch",
+				"2023-03-26T12:00:00+02:00 2023-03-26T13:00:00+02:00 lunch",
+				"2023-03-28T12:00:00+02:00 2023-03-28T13:00:00+02:00 lunch",
+			},
+		},
+		{
+			name: "yearly on month day",
+			body: `BEGIN:VEVENT
+UID:review
+DTSTART:20210131T100000Z
+DTEND:20210131T110000Z
+RRULE:FREQ=YEARLY;BYMONTH=1,2;BYMONTHDAY=-1;COUNT=3
+SUMMARY:review
+END:VEVENT
+`,
+			want: []string{
+				"2021-01-31T10:00:00Z 2021-01-31T11:00:00Z review",
+				"2021-02-28T10:00:00Z 2021-02-28T11:00:00Z review",
+				"2022-01-31T10:00:00Z 2022-01-31T11:00:00Z review",
+			},
+		},
+		{
+			name: "monthly on last weekday",
+			body: `BEGIN:VEVENT
+UID:report
+DTSTART:20230331T090000Z
+DTEND:20230331T100000Z
+RRULE:FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=3
+SUMMARY:report
+END:VEVENT
+`,
+			want: []string{
+				"2023-03-31T09:00:00Z 2023-03-31T10:00:00Z report",
+				"2023-04-28T09:00:00Z 2023-04-28T10:00:00Z report",
+				"2023-05-31T09:00:00Z 2023-05-31T10:00:00Z report",
+			},
+		},
+		{
+			name: "unsupported rule skips only its series",
+			body: `BEGIN:VEVENT
+UID:odd
+DTSTART:20230306T090000Z
+DTEND:20230306T100000Z
+RRULE:FREQ=YEARLY;BYWEEKNO=10
+SUMMARY:odd
+END:VEVENT
+BEGIN:VEVENT
+UID:odd
+RECURRENCE-ID:20240304T090000Z
+DTSTART:20240304T110000Z
+DTEND:20240304T120000Z
+SUMMARY:odd moved
+END:VEVENT
+BEGIN:VEVENT
+UID:plain
+DTSTART:20230306T130000Z
+DTEND:20230306T140000Z
+SUMMARY:plain
+END:VEVENT
+`,
+			want: []string{
+				"2023-03-06T13:00:00Z 2023-03-06T14:00:00Z plain",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, readEvents(t, tt.body, tt.opts))
+		})
+	}
+}
+
+func TestReadAttendees(t *testing.T) {
+	events, err := Read(strings.NewReader(calendarHeader+`X-WR-CALNAME:me@example.com
+BEGIN:VEVENT
+UID:meeting
+DTSTART:20230325T130000Z
+DTEND:20230325T140000Z
+ORGANIZER;CN=Boss:mailto:boss@example.com
+ATTENDEE;CN="Boss";PARTSTAT=ACCEPTED:mailto:boss@example.com
+ATTENDEE;PARTSTAT=DECLINED;ROLE=OPT-PARTICIPANT:MAILTO:me@example.com
+ATTENDEE;CUTYPE=ROOM:mailto:room@example.com
+RRULE:FREQ=DAILY;COUNT=2
+SUMMARY:sync
+END:VEVENT
+`+calendarFooter), Options{Location: time.UTC})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	e := events[1]
+	assert.Equal(t, "meeting_20230326T130000Z", e.Id)
+	assert.Equal(t, "meeting", e.RecurringEventId)
+	assert.Equal(t, "boss@example.com", e.Organizer.Email)
+	assert.False(t, e.Organizer.Self)
+	require.Len(t, e.Attendees, 3)
+	assert.True(t, e.Attendees[0].Organizer)
+	assert.Equal(t, "accepted", e.Attendees[0].ResponseStatus)
+	assert.True(t, e.Attendees[1].Self)
+	assert.True(t, e.Attendees[1].Optional)
+	assert.Equal(t, "declined", e.Attendees[1].ResponseStatus)
+	assert.True(t, e.Attendees[2].Resource)
+	assert.Equal(t, "needsAction", e.Attendees[2].ResponseStatus)
+}
+
+const outlookTimeZones = `BEGIN:VTIMEZONE
+TZID:W. Europe Standard Time
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VTIMEZONE
+TZID:(UTC+05:30) Chennai\, Kolkata\, Mumbai\, New Delhi
+BEGIN:STANDARD
+DTSTART:16010101T000000
+TZOFFSETFROM:+0530
+TZOFFSETTO:+0530
+END:STANDARD
+END:VTIMEZONE
+`
+
+func TestReadOutlookTimeZones(t *testing.T) {
+	got := readEvents(t, outlookTimeZones+`BEGIN:VEVENT
+UID:sync
+DTSTART;TZID=W. Europe Standard Time:20230324T100000
+DTEND;TZID=W. Europe Standard Time:20230324T110000
+RRULE:FREQ=DAILY;COUNT=2;INTERVAL=3
+SUMMARY:sync
+END:VEVENT
+BEGIN:VEVENT
+UID:autumn
+DTSTART;TZID=W. Europe Standard Time:20231029T013000
+DTEND;TZID=W. Europe Standard Time:20231029T040000
+SUMMARY:night shift
+END:VEVENT
+BEGIN:VEVENT
+UID:call
+DTSTART;TZID="(UTC+05:30) Chennai, Kolkata, Mumbai, New Delhi":20230324T100000
+DTEND;TZID="(UTC+05:30) Chennai, Kolkata, Mumbai, New Delhi":20230324T103000
+SUMMARY:call
+END:VEVENT
+`, Options{})
+	assert.Equal(t, []string{
+		"2023-03-24T10:00:00+01:00 2023-03-24T11:00:00+01:00 sync",
+		"2023-03-27T10:00:00+02:00 2023-03-27T11:00:00+02:00 sync",
+		"2023-10-29T01:30:00+02:00 2023-10-29T04:00:00+01:00 night shift",
+		"2023-03-24T10:00:00+05:30 2023-03-24T10:30:00+05:30 call",
+	}, got)
+}
+
+func TestVTimezoneLocation(t *testing.T) {
+	top, err := parse(strings.NewReader(calendarHeader + outlookTimeZones + calendarFooter))
+	require.NoError(t, err)
+	loc, err := vtimezoneLocation(top[0].components[0])
+	require.NoError(t, err)
+	assert.Equal(t, "W. Europe Standard Time", loc.String())
+	for _, tt := range []struct {
+		utc    time.Time
+		offset int
+	}{
+		{time.Date(1999, 7, 1, 12, 0, 0, 0, time.UTC), 2 * 3600},
+		{time.Date(2023, 3, 26, 0, 59, 59, 0, time.UTC), 3600},
+		{time.Date(2023, 3, 26, 1, 0, 0, 0, time.UTC), 2 * 3600},
+		{time.Date(2023, 10, 29, 0, 59, 59, 0, time.UTC), 2 * 3600},
+		{time.Date(2023, 10, 29, 1, 0, 0, 0, time.UTC), 3600},
+		{time.Date(2040, 7, 1, 12, 0, 0, 0, time.UTC), 3600},
+	} {
+		_, offset := tt.utc.In(loc).Zone()
+		assert.Equal(t, tt.offset, offset, tt.utc)
+	}
+}
@@ -0,0 +1,188 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package ics reads events from iCalendar (RFC 5545) files, such as those
+// exported by Thunderbird, Outlook or Google Takeout.
+package ics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+func (p *property) param(name string) string {
+	return p.params[name]
+}
+
+type component struct {
+	name       string
+	props      []*property
+	components []*component
+}
+
+// prop returns the first property with the given name, or nil.
+func (c *component) prop(name string) *property {
+	for _, p := range c.props {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// propsNamed returns all properties with the given name.
+func (c *component) propsNamed(name string) []*property {
+	var ret []*property
+	for _, p := range c.props {
+		if p.name == name {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// text returns the unescaped value of the named property, or empty string.
+func (c *component) text(name string) string {
+	if p := c.prop(name); p != nil {
+		return unescapeText(p.value)
+	}
+	return ""
+}
+
+// parse reads all top-level components from r.
+func parse(r io.Reader) ([]*component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var top []*component
+	var stack []*component
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		switch p.name {
+		case "BEGIN":
+			stack = append(stack, &component{name: strings.ToUpper(p.value)})
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].name != strings.ToUpper(p.value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, p.value)
+			}
+			c := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				top = append(top, c)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.components = append(parent.components, c)
+			}
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property %s outside of any component", i+1, p.name)
+			}
+			c := stack[len(stack)-1]
+			c.props = append(c.props, p)
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unterminated component %s", stack[len(stack)-1].name)
+	}
+	return top, nil
+}
+
+// unfold returns logical content lines, joining lines continued with leading whitespace.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseProperty splits a content line into name, parameters and value.
+func parseProperty(line string) (*property, error) {
+	p := &property{params: make(map[string]string)}
+	i := strings.IndexAny(line, ";:")
+	if i < 0 {
+		return nil, fmt.Errorf("malformed content line %q", line)
+	}
+	p.name = strings.ToUpper(line[:i])
+	rest := line[i:]
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("malformed parameter in %q", line)
+		}
+		name := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+		var values []string
+		for {
+			var value string
+			if strings.HasPrefix(rest, `"`) {
+				end := strings.Index(rest[1:], `"`)
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated quoted parameter in %q", line)
+				}
+				value = rest[1 : end+1]
+				rest = rest[end+2:]
+			} else {
+				end := strings.IndexAny(rest, ",;:")
+				if end < 0 {
+					return nil, fmt.Errorf("malformed parameter in %q", line)
+				}
+				value = rest[:end]
+				rest = rest[end:]
+			}
+			values = append(values, value)
+			if !strings.HasPrefix(rest, ",") {
+				break
+			}
+			rest = rest[1:]
+		}
+		p.params[name] = strings.Join(values, ",")
+	}
+	if !strings.HasPrefix(rest, ":") {
+		return nil, fmt.Errorf("malformed content line %q", line)
+	}
+	p.value = rest[1:]
+	return p, nil
+}
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, "\n", `\N`, "\n")
+
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
@@ -0,0 +1,352 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package ics
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPeriods bounds recurrence expansion of rules which never end.
+const maxPeriods = 100000
+
+type weekdayNum struct {
+	n   int // 0 means every such weekday in the period
+	day time.Weekday
+}
+
+// rrule is the subset of an RFC 5545 recurrence rule that calendar clients commonly produce.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []weekdayNum
+	byMonthDay []int
+	byMonth    []time.Month
+	bySetPos   []int
+	wkst       time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+func parseRRule(value string, z *zones) (*rrule, error) {
+	r := &rrule{interval: 1, wkst: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		name, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed RRULE part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.freq = strings.ToUpper(val)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(val)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(val)
+		case "UNTIL":
+			r.until, _, err = z.parseTime(val, "")
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				var wn weekdayNum
+				wn, err = parseWeekdayNum(d)
+				if err != nil {
+					break
+				}
+				r.byDay = append(r.byDay, wn)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(val, ",") {
+				var n int
+				n, err = strconv.Atoi(d)
+				if err != nil {
+					break
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, m := range strings.Split(val, ",") {
+				var n int
+				n, err = strconv.Atoi(m)
+				if err != nil {
+					break
+				}
+				r.byMonth = append(r.byMonth, time.Month(n))
+			}
+		case "BYSETPOS":
+			for _, p := range strings.Split(val, ",") {
+				var n int
+				n, err = strconv.Atoi(p)
+				if err == nil && n == 0 {
+					err = fmt.Errorf("must not be zero")
+				}
+				if err != nil {
+					break
+				}
+				r.bySetPos = append(r.bySetPos, n)
+			}
+		case "WKST":
+			day, ok := weekdays[strings.ToUpper(val)]
+			if !ok {
+				err = fmt.Errorf("unknown weekday")
+			}
+			r.wkst = day
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part %q", part)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE part %q: %w", part, err)
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported RRULE frequency %q", r.freq)
+	}
+	return r, nil
+}
+
+func parseWeekdayNum(s string) (weekdayNum, error) {
+	s = strings.ToUpper(s)
+	if len(s) < 2 {
+		return weekdayNum{}, fmt.Errorf("invalid weekday %q", s)
+	}
+	day, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return weekdayNum{}, fmt.Errorf("invalid weekday %q", s)
+	}
+	wn := weekdayNum{day: day}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil {
+			return weekdayNum{}, fmt.Errorf("invalid weekday %q", s)
+		}
+		wn.n = n
+	}
+	return wn, nil
+}
+
+// expand returns the start times of occurrences of the rule beginning at dtstart,
+// which start before limit.
+func (r *rrule) expand(dtstart, limit time.Time) []time.Time {
+	var ret []time.Time
+	hour, min, sec := dtstart.Clock()
+	loc := dtstart.Location()
+	emitted := 0
+	for period := 0; period < maxPeriods; period++ {
+		first, days := r.periodDays(dtstart, period)
+		if !first.Before(limit) {
+			break
+		}
+		if !r.until.IsZero() && first.After(r.until) {
+			break
+		}
+		for _, day := range days {
+			t := time.Date(day.Year(), day.Month(), day.Day(), hour, min, sec, 0, loc)
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.until.IsZero() && t.After(r.until) {
+				return ret
+			}
+			if r.count > 0 && emitted >= r.count {
+				return ret
+			}
+			if !t.Before(limit) {
+				return ret
+			}
+			emitted++
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// periodDays returns the first day of the n-th period of the rule, and the
+// candidate days in that period, in order.
+func (r *rrule) periodDays(dtstart time.Time, n int) (time.Time, []time.Time) {
+	loc := dtstart.Location()
+	startDay := time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, loc)
+	var first time.Time
+	var days []time.Time
+	switch r.freq {
+	case "DAILY":
+		first = startDay.AddDate(0, 0, n*r.interval)
+		if r.matchesFilters(first) {
+			days = []time.Time{first}
+		}
+	case "WEEKLY":
+		offset := (int(startDay.Weekday()) - int(r.wkst) + 7) % 7
+		first = startDay.AddDate(0, 0, -offset+7*n*r.interval)
+		wanted := r.byDay
+		if len(wanted) == 0 {
+			wanted = []weekdayNum{{day: dtstart.Weekday()}}
+		}
+		for _, wd := range wanted {
+			day := first.AddDate(0, 0, (int(wd.day)-int(r.wkst)+7)%7)
+			if r.matchesMonth(day) {
+				days = append(days, day)
+			}
+		}
+	case "MONTHLY":
+		first = time.Date(dtstart.Year(), dtstart.Month()+time.Month(n*r.interval), 1, 0, 0, 0, 0, loc)
+		if r.matchesMonth(first) {
+			days = r.monthDays(first, dtstart.Day())
+		}
+	case "YEARLY":
+		first = time.Date(dtstart.Year()+n*r.interval, time.January, 1, 0, 0, 0, 0, loc)
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []time.Month{dtstart.Month()}
+		}
+		for _, m := range months {
+			days = append(days, r.monthDays(time.Date(first.Year(), m, 1, 0, 0, 0, 0, loc), dtstart.Day())...)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	if len(r.bySetPos) > 0 {
+		days = r.setPositions(days)
+	}
+	return first, days
+}
+
+// setPositions returns the days at BYSETPOS positions among the candidate days
+// of a period, in order. Negative positions count from the end.
+func (r *rrule) setPositions(days []time.Time) []time.Time {
+	var ret []time.Time
+	for _, pos := range r.bySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(days) + pos
+		}
+		if i >= 0 && i < len(days) && !slices.ContainsFunc(ret, days[i].Equal) {
+			ret = append(ret, days[i])
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Before(ret[j]) })
+	return ret
+}
+
+// monthDays returns candidate days of the month beginning at monthStart.
+// defaultDay is used when the rule specifies neither BYMONTHDAY nor BYDAY.
+func (r *rrule) monthDays(monthStart time.Time, defaultDay int) []time.Time {
+	length := monthStart.AddDate(0, 1, -1).Day()
+	var days []time.Time
+	addDay := func(d int) {
+		if d < 0 {
+			d = length + 1 + d
+		}
+		if d >= 1 && d <= length {
+			days = append(days, monthStart.AddDate(0, 0, d-1))
+		}
+	}
+	switch {
+	case len(r.byMonthDay) > 0:
+		for _, d := range r.byMonthDay {
+			addDay(d)
+		}
+		if len(r.byDay) > 0 {
+			var filtered []time.Time
+			for _, day := range days {
+				if r.matchesWeekday(day) {
+					filtered = append(filtered, day)
+				}
+			}
+			days = filtered
+		}
+	case len(r.byDay) > 0:
+		for _, wd := range r.byDay {
+			firstOfKind := 1 + (int(wd.day)-int(monthStart.Weekday())+7)%7
+			switch {
+			case wd.n == 0:
+				for d := firstOfKind; d <= length; d += 7 {
+					addDay(d)
+				}
+			case wd.n > 0:
+				d := firstOfKind + 7*(wd.n-1)
+				if d <= length {
+					addDay(d)
+				}
+			default:
+				lastOfKind := firstOfKind + 7*((length-firstOfKind)/7)
+				d := lastOfKind + 7*(wd.n+1)
+				if d >= 1 {
+					addDay(d)
+				}
+			}
+		}
+	default:
+		addDay(defaultDay)
+	}
+	return days
+}
+
+func (r *rrule) matchesFilters(day time.Time) bool {
+	return r.matchesMonth(day) && r.matchesWeekday(day) && r.matchesMonthDay(day)
+}
+
+func (r *rrule) matchesMonth(day time.Time) bool {
+	if len(r.byMonth) == 0 {
+		return true
+	}
+	for _, m := range r.byMonth {
+		if day.Month() == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesWeekday(day time.Time) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	for _, wd := range r.byDay {
+		if day.Weekday() == wd.day {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchesMonthDay(day time.Time) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+	length := day.AddDate(0, 1, -day.Day()).Day()
+	for _, d := range r.byMonthDay {
+		if d == day.Day() || length+1+d == day.Day() {
+			return true
+		}
+	}
+	return false
+}
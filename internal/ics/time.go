@@ -0,0 +1,146 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package ics
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405"
+)
+
+// zones resolves TZID parameters to locations.
+type zones struct {
+	fallback *time.Location
+	cache    map[string]*time.Location
+	// defined maps TZIDs to VTIMEZONE components which describe them.
+	defined map[string]*component
+}
+
+func newZones(fallback *time.Location) *zones {
+	return &zones{fallback: fallback, cache: make(map[string]*time.Location), defined: make(map[string]*component)}
+}
+
+// define makes the zone described by a VTIMEZONE component available for lookup.
+func (z *zones) define(vtimezone *component) {
+	z.defined[vtimezone.text("TZID")] = vtimezone
+}
+
+func (z *zones) lookup(tzid string) *time.Location {
+	if tzid == "" {
+		return z.fallback
+	}
+	if loc, ok := z.cache[tzid]; ok {
+		return loc
+	}
+	// Some producers prefix the Olson name with a slash, meaning "globally unique".
+	// Others, like Outlook, use names of their own, which only the VTIMEZONE explains.
+	loc, err := time.LoadLocation(strings.TrimPrefix(tzid, "/"))
+	if vtimezone, ok := z.defined[tzid]; err != nil && ok {
+		loc, err = vtimezoneLocation(vtimezone)
+	}
+	if err != nil {
+		log.Printf("Unknown time zone %q, using %s instead: %s", tzid, z.fallback, err)
+		loc = z.fallback
+	}
+	z.cache[tzid] = loc
+	return loc
+}
+
+// parseTimes parses a (possibly comma-separated) DATE or DATE-TIME property value.
+// The returned bool is true if the values are dates rather than date-times.
+func (z *zones) parseTimes(p *property) ([]time.Time, bool, error) {
+	var ret []time.Time
+	allDay := p.param("VALUE") == "DATE"
+	for _, v := range strings.Split(p.value, ",") {
+		t, isDate, err := z.parseTime(v, p.param("TZID"))
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid %s value %q: %w", p.name, p.value, err)
+		}
+		allDay = allDay || isDate
+		ret = append(ret, t)
+	}
+	return ret, allDay, nil
+}
+
+func (z *zones) parseTime(v, tzid string) (time.Time, bool, error) {
+	switch {
+	case len(v) == len(dateFormat):
+		t, err := time.ParseInLocation(dateFormat, v, z.fallback)
+		return t, true, err
+	case strings.HasSuffix(v, "Z"):
+		t, err := time.ParseInLocation(dateTimeFormat, strings.TrimSuffix(v, "Z"), time.UTC)
+		return t, false, err
+	default:
+		t, err := time.ParseInLocation(dateTimeFormat, v, z.lookup(tzid))
+		return t, false, err
+	}
+}
+
+// parseDuration parses an RFC 5545 duration value such as "PT1H30M" or "-P1D".
+func parseDuration(v string) (time.Duration, error) {
+	s := v
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	s = s[1:]
+	var d time.Duration
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' {
+			inTime = true
+			s = s[1:]
+			continue
+		}
+		i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", v, err)
+		}
+		unit := s[i]
+		s = s[i+1:]
+		switch {
+		case unit == 'W' && !inTime:
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case unit == 'D' && !inTime:
+			d += time.Duration(n) * 24 * time.Hour
+		case unit == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case unit == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case unit == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+	}
+	return sign * d, nil
+}
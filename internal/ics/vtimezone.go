@@ -0,0 +1,189 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package ics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// zoneLimit is where expansion of VTIMEZONE rules stops. Time zone data in the
+// format time.LoadLocationFromTZData reads cannot describe transitions after it,
+// so the last offset stays in effect from then on.
+var zoneLimit = time.Unix(math.MaxInt32, 0)
+
+// zoneType is an offset from UTC in effect between transitions.
+type zoneType struct {
+	offset int
+	isDST  bool
+	abbr   string
+}
+
+// transition is a change to another offset from UTC.
+type transition struct {
+	at   int64
+	from int
+	to   zoneType
+}
+
+// vtimezoneLocation returns the location described by the STANDARD and DAYLIGHT
+// observances of a VTIMEZONE component, such as the ones Outlook writes for
+// zones like "W. Europe Standard Time".
+func vtimezoneLocation(vtimezone *component) (*time.Location, error) {
+	// Observances are given in local time, which parses into UTC the way
+	// floating times would, before the offset is subtracted.
+	utc := newZones(time.UTC)
+	var transitions []transition
+	for _, observance := range vtimezone.components {
+		if observance.name != "STANDARD" && observance.name != "DAYLIGHT" {
+			continue
+		}
+		from, err := parseOffset(observance.text("TZOFFSETFROM"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid TZOFFSETFROM: %w", observance.name, err)
+		}
+		to, err := parseOffset(observance.text("TZOFFSETTO"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid TZOFFSETTO: %w", observance.name, err)
+		}
+		dtstart := observance.prop("DTSTART")
+		if dtstart == nil {
+			return nil, fmt.Errorf("%s: missing DTSTART", observance.name)
+		}
+		first, _, err := utc.parseTime(dtstart.value, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid DTSTART: %w", observance.name, err)
+		}
+		starts := []time.Time{first}
+		if rruleProp := observance.prop("RRULE"); rruleProp != nil {
+			rule, err := parseRRule(rruleProp.value, utc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", observance.name, err)
+			}
+			starts = rule.expand(first, zoneLimit)
+		}
+		for _, p := range observance.propsNamed("RDATE") {
+			times, _, err := utc.parseTimes(p)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", observance.name, err)
+			}
+			starts = append(starts, times...)
+		}
+		zt := zoneType{offset: to, isDST: observance.name == "DAYLIGHT", abbr: observance.text("TZNAME")}
+		if zt.abbr == "" {
+			zt.abbr = formatOffset(to)
+		}
+		for _, start := range starts {
+			transitions = append(transitions, transition{at: start.Unix() - int64(from), from: from, to: zt})
+		}
+	}
+	if len(transitions) == 0 {
+		return nil, fmt.Errorf("no STANDARD or DAYLIGHT observances")
+	}
+	sort.SliceStable(transitions, func(i, j int) bool { return transitions[i].at < transitions[j].at })
+	return time.LoadLocationFromTZData(vtimezone.text("TZID"), tzData(transitions))
+}
+
+// tzData encodes transitions in the version 1 format of tzfile(5).
+func tzData(transitions []transition) []byte {
+	// The first type is the one in effect before the first transition which can be encoded.
+	initial := zoneType{offset: transitions[0].from, abbr: formatOffset(transitions[0].from)}
+	var kept []transition
+	for _, t := range transitions {
+		switch {
+		case t.at < math.MinInt32:
+			initial = t.to
+		case t.at <= math.MaxInt32:
+			kept = append(kept, t)
+		}
+	}
+	types := []zoneType{initial}
+	typeIndex := func(zt zoneType) uint8 {
+		for i, t := range types {
+			if t == zt {
+				return uint8(i)
+			}
+		}
+		types = append(types, zt)
+		return uint8(len(types) - 1)
+	}
+	indices := make([]uint8, len(kept))
+	for i, t := range kept {
+		indices[i] = typeIndex(t.to)
+	}
+	var abbrs bytes.Buffer
+	abbrIndex := make([]uint8, len(types))
+	for i, t := range types {
+		abbrIndex[i] = uint8(abbrs.Len())
+		abbrs.WriteString(t.abbr)
+		abbrs.WriteByte(0)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("TZif")
+	b.Write(make([]byte, 16)) // version 1 and reserved bytes
+	for _, n := range []int{0, 0, 0, len(kept), len(types), abbrs.Len()} {
+		binary.Write(&b, binary.BigEndian, uint32(n))
+	}
+	for _, t := range kept {
+		binary.Write(&b, binary.BigEndian, int32(t.at))
+	}
+	b.Write(indices)
+	for i, t := range types {
+		binary.Write(&b, binary.BigEndian, int32(t.offset))
+		var isDST uint8
+		if t.isDST {
+			isDST = 1
+		}
+		b.Write([]byte{isDST, abbrIndex[i]})
+	}
+	b.Write(abbrs.Bytes())
+	return b.Bytes()
+}
+
+// parseOffset parses a UTC offset such as "+0100" or "-053000" into seconds.
+func parseOffset(v string) (int, error) {
+	if (len(v) != 5 && len(v) != 7) || (v[0] != '+' && v[0] != '-') {
+		return 0, fmt.Errorf("invalid UTC offset %q", v)
+	}
+	var parts [3]int
+	for i := 0; 1+2*i < len(v); i++ {
+		n, err := strconv.Atoi(v[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid UTC offset %q", v)
+		}
+		parts[i] = n
+	}
+	offset := parts[0]*3600 + parts[1]*60 + parts[2]
+	if v[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
+
+// formatOffset returns an abbreviation for an offset which has no TZNAME, such as "+0530".
+func formatOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset/60%60)
+}
@@ -0,0 +1,230 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package io
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/source"
+	"google.golang.org/api/calendar/v3"
+)
+
+// cacheVersion is the version of the cache file format written by this program.
+const cacheVersion = 1
+
+func init() {
+	source.Register("cache", func(arg string, _ source.Options) (source.EventSource, error) {
+		return &cacheFileSource{fileName: arg}, nil
+	})
+}
+
+// cacheFile is the contents of a file written by a cachedSource.
+type cacheFile struct {
+	Version int `json:"version"`
+	// Source identifies the calendars the events were read from.
+	Source string `json:"source"`
+	// Ranges are the time ranges for which the file holds all events, in order.
+	Ranges []cachedRange     `json:"ranges"`
+	Events []*calendar.Event `json:"events"`
+}
+
+type cachedRange struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// missing returns the parts of the given time range not covered by the cached ranges.
+func (c *cacheFile) missing(start, end time.Time) []cachedRange {
+	var gaps []cachedRange
+	for _, r := range c.Ranges {
+		if !r.End.After(start) {
+			continue
+		}
+		if !r.Start.Before(end) {
+			break
+		}
+		if r.Start.After(start) {
+			gaps = append(gaps, cachedRange{Start: start, End: r.Start})
+		}
+		start = r.End
+	}
+	if start.Before(end) {
+		gaps = append(gaps, cachedRange{Start: start, End: end})
+	}
+	return gaps
+}
+
+// expire forgets ranges fetched before the given time, and returns them.
+func (c *cacheFile) expire(before time.Time) []cachedRange {
+	var kept, expired []cachedRange
+	for _, r := range c.Ranges {
+		if r.FetchedAt.Before(before) {
+			expired = append(expired, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	c.Ranges = kept
+	return expired
+}
+
+// add replaces cached events overlapping the range with the given ones, and marks the range as covered.
+func (c *cacheFile) add(r cachedRange, events []*calendar.Event) {
+	fetched := make(map[string]bool)
+	for _, e := range events {
+		fetched[e.Id] = true
+	}
+	stale := make(map[*calendar.Event]bool)
+	for _, e := range source.Overlapping(c.Events, r.Start, r.End) {
+		stale[e] = true
+	}
+	kept := events
+	for _, e := range c.Events {
+		if !stale[e] && !fetched[e.Id] {
+			kept = append(kept, e)
+		}
+	}
+	c.Events = kept
+
+	c.Ranges = append(c.Ranges, r)
+	sort.Slice(c.Ranges, func(i, j int) bool { return c.Ranges[i].Start.Before(c.Ranges[j].Start) })
+	merged := c.Ranges[:1]
+	for _, r := range c.Ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start.After(last.End) {
+			merged = append(merged, r)
+			continue
+		}
+		if r.End.After(last.End) {
+			last.End = r.End
+		}
+		if r.FetchedAt.Before(last.FetchedAt) {
+			last.FetchedAt = r.FetchedAt
+		}
+	}
+	c.Ranges = merged
+}
+
+// cacheFileSource reads events from a file previously written by a cachedSource.
+type cacheFileSource struct {
+	fileName string
+}
+
+func (c *cacheFileSource) List(_ context.Context, start, end time.Time) ([]*calendar.Event, error) {
+	cache, err := readFromFile(c.fileName)
+	if err != nil {
+		return nil, err
+	}
+	return source.Overlapping(cache.Events, start, end), nil
+}
+
+// cachedSource saves events fetched from another source in a file, and uses it instead
+// for the time ranges it covers.
+type cachedSource struct {
+	source.EventSource
+	fileName string
+	sourceID string
+	ttl      time.Duration
+}
+
+// NewCachedSource returns a source which keeps events read from src in a JSON file.
+// Only events from time ranges not covered by the file yet are fetched from src.
+// The sourceID identifies src, so that a file holding events from a different source is not used.
+// If ttl is not zero, time ranges fetched longer ago are fetched again.
+func NewCachedSource(src source.EventSource, fileName, sourceID string, ttl time.Duration) source.EventSource {
+	return &cachedSource{EventSource: src, fileName: fileName, sourceID: sourceID, ttl: ttl}
+}
+
+func (c *cachedSource) List(ctx context.Context, start, end time.Time) ([]*calendar.Event, error) {
+	cache, err := readFromFile(c.fileName)
+	switch {
+	case os.IsNotExist(err):
+		cache = &cacheFile{}
+	case err != nil:
+		log.Printf("Failed to read events from %q, fetching them again: %s", c.fileName, err)
+		cache = &cacheFile{}
+	case cache.Version == 0:
+		log.Printf("Cache %q was written by an older version of this program, fetching events again.", c.fileName)
+		cache = &cacheFile{}
+	case cache.Source != c.sourceID:
+		log.Printf("Cache %q holds events from %q rather than %q, fetching them again.", c.fileName, cache.Source, c.sourceID)
+		cache = &cacheFile{}
+	}
+	cache.Version = cacheVersion
+	cache.Source = c.sourceID
+
+	now := time.Now()
+	if c.ttl != 0 {
+		for _, r := range cache.expire(now.Add(-c.ttl)) {
+			log.Printf("Cached events from %s to %s are older than %s.", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339), c.ttl)
+		}
+	}
+	gaps := cache.missing(start, end)
+	for _, gap := range gaps {
+		log.Printf("Fetching events from %s to %s.", gap.Start.Format(time.RFC3339), gap.End.Format(time.RFC3339))
+		events, err := c.EventSource.List(ctx, gap.Start, gap.End)
+		if err != nil {
+			return nil, err
+		}
+		gap.FetchedAt = now
+		cache.add(gap, events)
+	}
+	if len(gaps) > 0 {
+		if err = writeToFile(c.fileName, cache); err != nil {
+			return nil, fmt.Errorf("failed to write events to %q: %s", c.fileName, err)
+		}
+	}
+	return source.Overlapping(cache.Events, start, end), nil
+}
+
+func writeToFile(s string, cache *cacheFile) error {
+	cacheJson, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s, cacheJson, os.ModePerm)
+}
+
+// readFromFile reads a cache file.
+// Files written by earlier versions of this program, which hold just a list of events, are read
+// as covering no time range.
+func readFromFile(s string) (*cacheFile, error) {
+	cacheBytes, err := os.ReadFile(s)
+	if err != nil {
+		return nil, err
+	}
+	cache := &cacheFile{}
+	if bytes.HasPrefix(bytes.TrimSpace(cacheBytes), []byte("[")) {
+		err = json.Unmarshal(cacheBytes, &cache.Events)
+	} else {
+		err = json.Unmarshal(cacheBytes, cache)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cache.Version > cacheVersion {
+		return nil, fmt.Errorf("unsupported cache file version %d", cache.Version)
+	}
+	return cache, nil
+}
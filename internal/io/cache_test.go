@@ -0,0 +1,107 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package io
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/calendar/v3"
+)
+
+// recordingSource remembers the time ranges it was asked for.
+type recordingSource struct {
+	*source.Memory
+	calls []string
+}
+
+func (r *recordingSource) List(ctx context.Context, start, end time.Time) ([]*calendar.Event, error) {
+	r.calls = append(r.calls, start.Format("Jan 2")+"-"+end.Format("Jan 2"))
+	return r.Memory.List(ctx, start, end)
+}
+
+func day(d int) time.Time {
+	return time.Date(2023, 3, d, 0, 0, 0, 0, time.UTC)
+}
+
+func summaries(events []*calendar.Event) []string {
+	var ret []string
+	for _, e := range events {
+		ret = append(ret, e.Summary)
+	}
+	return ret
+}
+
+func TestCachedSource(t *testing.T) {
+	memory, err := source.ParseFixture(`
+- {id: a, summary: monday, start: 2023-03-06T10:00:00Z, end: 2023-03-06T11:00:00Z}
+- {id: b, summary: overnight, start: 2023-03-12T23:00:00Z, end: 2023-03-13T01:00:00Z}
+- {id: c, summary: next monday, start: 2023-03-13T10:00:00Z, end: 2023-03-13T11:00:00Z}
+`)
+	require.NoError(t, err)
+	inner := &recordingSource{Memory: memory}
+	fileName := filepath.Join(t.TempDir(), "cache.json")
+	ctx := context.Background()
+
+	cached := NewCachedSource(inner, fileName, "primary", 0)
+	_, isUpdater := cached.(source.Updater)
+	assert.False(t, isUpdater, "cached events would keep old summaries")
+	events, err := cached.List(ctx, day(6), day(13))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"monday", "overnight"}, summaries(events))
+
+	memory.Events[1].Summary = "overnight, renamed"
+	events, err = cached.List(ctx, day(8), day(20))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"overnight, renamed", "next monday"}, summaries(events))
+	assert.Equal(t, []string{"Mar 6-Mar 13", "Mar 13-Mar 20"}, inner.calls)
+
+	events, err = cached.List(ctx, day(1), day(21))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"monday", "overnight, renamed", "next monday"}, summaries(events))
+	assert.Equal(t, []string{"Mar 6-Mar 13", "Mar 13-Mar 20", "Mar 1-Mar 6", "Mar 20-Mar 21"}, inner.calls)
+
+	inner.calls = nil
+	_, err = NewCachedSource(inner, fileName, "other", 0).List(ctx, day(6), day(7))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Mar 6-Mar 7"}, inner.calls)
+
+	inner.calls = nil
+	_, err = NewCachedSource(inner, fileName, "other", time.Nanosecond).List(ctx, day(6), day(7))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Mar 6-Mar 7"}, inner.calls)
+}
+
+func TestCachedSourceReadsLegacyFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "cache.json")
+	require.NoError(t, os.WriteFile(fileName, []byte(`[{"id": "a", "summary": "old"}]`), 0600))
+
+	events, err := (&cacheFileSource{fileName: fileName}).List(context.Background(), day(1), day(2))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old"}, summaries(events))
+
+	inner := &recordingSource{Memory: source.NewMemory()}
+	events, err = NewCachedSource(inner, fileName, "primary", 0).List(context.Background(), day(1), day(2))
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	assert.Equal(t, []string{"Mar 1-Mar 2"}, inner.calls)
+}
@@ -16,10 +16,10 @@
 package io
 
 import (
-	"context"
 	"os"
 
 	"github.com/goccy/go-yaml"
+	"github.com/porridge/calendar-stats/internal/source"
 	"google.golang.org/api/calendar/v3"
 )
 
@@ -31,6 +31,7 @@ type Correction struct {
 	Summary   string `yaml:"summary"`
 	Id        string `yaml:"id"`
 	Organizer string `yaml:"organizer"`
+	Calendar  string `yaml:"calendar,omitempty"`
 }
 
 func LoadCorrections(fileName string) (*Corrections, error) {
@@ -46,26 +47,22 @@ func LoadCorrections(fileName string) (*Corrections, error) {
 	return c, nil
 }
 
-func MaybeUpdateSummary(ctx context.Context, source, id, summary string) error {
-	srv, err := newCalendarService(ctx)
-	if err != nil {
-		return err
-	}
-	_, err = srv.Events.Patch(source, id, &calendar.Event{Summary: summary}).SendUpdates("none").Do()
-	return err
-}
-
 func SaveUnrecognized(correctionsFileName string, unrecognized []*calendar.Event) error {
 	un := &Corrections{}
 	for _, e := range unrecognized {
-		organizer := e.Organizer.DisplayName
-		if organizer == "" {
-			organizer = e.Organizer.Email
+		var organizer string
+		// Not every source tells who organized an event.
+		if e.Organizer != nil {
+			organizer = e.Organizer.DisplayName
+			if organizer == "" {
+				organizer = e.Organizer.Email
+			}
 		}
 		un.Corrections = append(un.Corrections, &Correction{
 			Id:        e.Id,
 			Summary:   e.Summary,
 			Organizer: organizer,
+			Calendar:  source.CalendarOf(e),
 		})
 	}
 	data, err := yaml.Marshal(un)
@@ -0,0 +1,57 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package io
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/porridge/calendar-stats/internal/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveUnrecognized(t *testing.T) {
+	// An invitation with a response but no organizer has none in the fixture, as with some other sources.
+	memory, err := source.ParseFixture(`
+- id: a
+  summary: reaad mail
+  start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T10:00:00Z
+- id: b
+  summary: sycn
+  start: 2023-03-27T11:00:00Z
+  end: 2023-03-27T12:00:00Z
+  response: accepted
+- id: c
+  summary: 1:1
+  start: 2023-03-27T13:00:00Z
+  end: 2023-03-27T14:00:00Z
+  organizer: boss@example.com
+`)
+	require.NoError(t, err)
+	require.Nil(t, memory.Events[1].Organizer)
+	fileName := filepath.Join(t.TempDir(), "corrections.yaml")
+
+	require.NoError(t, SaveUnrecognized(fileName, memory.Events))
+	corrections, err := LoadCorrections(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, []*Correction{
+		{Id: "a", Summary: "reaad mail"},
+		{Id: "b", Summary: "sycn"},
+		{Id: "c", Summary: "1:1", Organizer: "boss@example.com"},
+	}, corrections.Corrections)
+}
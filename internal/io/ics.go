@@ -0,0 +1,53 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package io
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/ics"
+	"github.com/porridge/calendar-stats/internal/source"
+	"google.golang.org/api/calendar/v3"
+)
+
+func init() {
+	source.Register("ics", func(arg string, opts source.Options) (source.EventSource, error) {
+		return &icsSource{fileName: arg, self: opts.Self}, nil
+	})
+}
+
+// icsSource reads events from an iCalendar file.
+type icsSource struct {
+	fileName string
+	// self lists email addresses which identify the calendar owner among attendees.
+	self []string
+}
+
+func (s *icsSource) List(_ context.Context, start, end time.Time) ([]*calendar.Event, error) {
+	f, err := os.Open(s.fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ics.Read(f, ics.Options{
+		Start:    start,
+		End:      end,
+		Location: time.Local,
+		Self:     s.self,
+	})
+}
@@ -17,78 +17,77 @@ package io
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/porridge/calendar-stats/internal/auth"
+	"github.com/porridge/calendar-stats/internal/source"
 
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/option"
 )
 
-func GetEvents(ctx context.Context, source string, start, end time.Time, cacheFilename string) ([]*calendar.Event, error) {
-	if cacheFilename != "" {
-		events, err := readFromFile(cacheFilename)
-		if err != nil {
-			log.Printf("Failed to read events from %q, fetching them and saving first: %s", cacheFilename, err)
-			events, err = fetchFromCalendar(ctx, source, start, end)
-			if err != nil {
-				return nil, fmt.Errorf("unable to fetch events from calendar: %s", err)
-			}
-			if err = writeToFile(cacheFilename, events); err != nil {
-				return nil, fmt.Errorf("failed to write events to %q: %s", cacheFilename, err)
-			}
-		}
-		return events, nil
-	} else {
-		events, err := fetchFromCalendar(ctx, source, start, end)
-		if err != nil {
-			return nil, fmt.Errorf("unable to fetch events from calendar: %s", err)
-		}
-		return events, nil
-	}
+func init() {
+	newService := shared(newCalendarService)
+	source.Register("google", func(arg string, _ source.Options) (source.EventSource, error) {
+		return &googleSource{calendarID: arg, newService: newService}, nil
+	})
 }
 
-func writeToFile(s string, events []*calendar.Event) error {
-	eventsJson, err := json.Marshal(events)
-	if err != nil {
-		return err
+// shared returns a function which calls newService once, and then always returns the same result.
+// Google calendars are read concurrently, and each of them connecting on its own
+// would start a separate authorization flow on the first run.
+func shared(newService func(context.Context) (*calendar.Service, error)) func(context.Context) (*calendar.Service, error) {
+	var once sync.Once
+	var srv *calendar.Service
+	var err error
+	return func(ctx context.Context) (*calendar.Service, error) {
+		once.Do(func() { srv, err = newService(ctx) })
+		return srv, err
 	}
-	return os.WriteFile(s, eventsJson, os.ModePerm)
 }
 
-func readFromFile(s string) ([]*calendar.Event, error) {
-	events := []*calendar.Event{}
-	eventBytes, err := os.ReadFile(s)
+// googleSource reads events from a Google calendar.
+type googleSource struct {
+	calendarID string
+	// newService connects to the Calendar API.
+	newService func(context.Context) (*calendar.Service, error)
+}
+
+func (g *googleSource) List(ctx context.Context, start, end time.Time) ([]*calendar.Event, error) {
+	srv, err := g.newService(ctx)
 	if err != nil {
 		return nil, err
 	}
-	err = json.Unmarshal(eventBytes, &events)
+	events, err := fetchFromCalendar(srv, g.calendarID, start, end)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("unable to fetch events from calendar: %s", err)
 	}
 	return events, nil
 }
 
-func fetchFromCalendar(ctx context.Context, source string, start, end time.Time) ([]*calendar.Event, error) {
-	srv, err := newCalendarService(ctx)
+func (g *googleSource) UpdateSummary(ctx context.Context, id, summary string) error {
+	srv, err := g.newService(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	_, err = srv.Events.Patch(g.calendarID, id, &calendar.Event{Summary: summary}).SendUpdates("none").Do()
+	return err
+}
 
+func fetchFromCalendar(srv *calendar.Service, source string, start, end time.Time) ([]*calendar.Event, error) {
 	allEvents := []*calendar.Event{}
 	var pageToken string
 	for {
+		// The listing includes events which span the boundaries of the time range.
+		// The parts outside of it are clipped when accounting for time.
 		events, err := srv.Events.List(source).
 			SingleEvents(true).
 			TimeMin(start.Format(time.RFC3339)).
 			TimeMax(end.Format(time.RFC3339)).
-			// TODO: put some padding in time min/max to include
-			// events which span week boundaries.
 			MaxResults(2500). // maximum page size according to docs
 			PageToken(pageToken).
 			Do()
@@ -0,0 +1,79 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package io
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+// fakeService returns a function which connects to the fake Calendar API served by server.
+func fakeService(server *httptest.Server) func(context.Context) (*calendar.Service, error) {
+	return func(ctx context.Context) (*calendar.Service, error) {
+		return calendar.NewService(ctx, option.WithEndpoint(server.URL+"/"), option.WithHTTPClient(server.Client()))
+	}
+}
+
+func TestGoogleSourceList(t *testing.T) {
+	fake := &fakeCalendar{full: [][]*calendar.Event{
+		{storeEvent("a", "overnight", "2023-03-26T22:00:00Z", "2023-03-27T06:00:00Z")},
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	src := &googleSource{
+		calendarID: "primary",
+		newService: fakeService(server),
+	}
+
+	events, err := src.List(context.Background(), time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC), time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"overnight"}, summaries(events))
+	require.Len(t, fake.queries, 1)
+	assert.Equal(t, "2023-03-27T00:00:00Z", fake.queries[0].Get("timeMin"))
+	assert.Equal(t, "2023-04-03T00:00:00Z", fake.queries[0].Get("timeMax"))
+}
+
+func TestGoogleSourcesShareService(t *testing.T) {
+	fake := &fakeCalendar{full: [][]*calendar.Event{
+		{storeEvent("a", "standup", "2023-03-27T09:00:00Z", "2023-03-27T09:15:00Z")},
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	var connections atomic.Int32
+	connect := fakeService(server)
+	newService := shared(func(ctx context.Context) (*calendar.Service, error) {
+		connections.Add(1)
+		return connect(ctx)
+	})
+	calendars := &source.Multi{}
+	for _, id := range []string{"a", "b", "c"} {
+		calendars.Add(id, &googleSource{calendarID: id, newService: newService})
+	}
+
+	_, err := calendars.List(context.Background(), time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC), time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, connections.Load())
+	assert.Len(t, fake.queries, 3)
+}
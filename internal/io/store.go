@@ -0,0 +1,210 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/source"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// eventStore is the on-disk copy of a Google calendar, kept up to date using incremental sync.
+type eventStore struct {
+	CalendarID string `json:"calendarId"`
+	// Since and Until delimit the time range in which the store holds all events.
+	// Zero Until means no limit, as in stores written before it was introduced.
+	Since     time.Time         `json:"since"`
+	Until     time.Time         `json:"until,omitempty"`
+	SyncToken string            `json:"syncToken"`
+	Events    []*calendar.Event `json:"events"`
+}
+
+// storeHorizon is how far past the requested time range, or the current time if
+// later, a full sync reaches. Without a limit it would fetch every future instance
+// of each recurring event which never ends. A short one would make runs which end
+// later than the previous ones sync fully each time, rather than incrementally.
+const storeHorizon = 365 * 24 * time.Hour
+
+// covers returns true if the store holds all events overlapping the given time range.
+func (s *eventStore) covers(start, end time.Time) bool {
+	return !start.Before(s.Since) && (s.Until.IsZero() || !end.After(s.Until))
+}
+
+// apply updates the store with changed events, removing cancelled ones.
+func (s *eventStore) apply(changes []*calendar.Event) {
+	index := make(map[string]int)
+	for i, e := range s.Events {
+		index[e.Id] = i
+	}
+	for _, e := range changes {
+		i, known := index[e.Id]
+		switch {
+		case e.Status == "cancelled" && known:
+			s.Events[i] = nil
+			delete(index, e.Id)
+		case e.Status == "cancelled":
+		case known:
+			s.Events[i] = e
+		default:
+			index[e.Id] = len(s.Events)
+			s.Events = append(s.Events, e)
+		}
+	}
+	events := s.Events[:0]
+	for _, e := range s.Events {
+		if e != nil {
+			events = append(events, e)
+		}
+	}
+	s.Events = events
+}
+
+// syncedSource serves events of a Google calendar from a local store,
+// fetching only the changes made since the previous run.
+type syncedSource struct {
+	*googleSource
+	fileName string
+}
+
+// NewSyncedSource returns a source which keeps a copy of the Google calendar read by src in a file in dir.
+// Sources other than Google calendars are returned unchanged.
+func NewSyncedSource(src source.EventSource, dir string) source.EventSource {
+	g, ok := src.(*googleSource)
+	if !ok {
+		return src
+	}
+	return &syncedSource{
+		googleSource: g,
+		fileName:     filepath.Join(dir, url.PathEscape(g.calendarID)+".json"),
+	}
+}
+
+func (s *syncedSource) List(ctx context.Context, start, end time.Time) ([]*calendar.Event, error) {
+	store, err := s.load()
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Ignoring unreadable event store %q: %s", s.fileName, err)
+	}
+	if store == nil || store.CalendarID != s.calendarID {
+		store = &eventStore{CalendarID: s.calendarID}
+	}
+
+	srv, err := s.newService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if store.SyncToken != "" && store.covers(start, end) {
+		err = s.syncIncrementally(srv, store)
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+			log.Printf("Sync token of calendar %q expired, syncing all events again.", s.calendarID)
+			store.SyncToken = ""
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if store.SyncToken == "" || !store.covers(start, end) {
+		until := time.Now()
+		if end.After(until) {
+			until = end
+		}
+		if err = s.syncFully(srv, store, start, until.Add(storeHorizon)); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.save(store); err != nil {
+		return nil, fmt.Errorf("failed to save event store %q: %w", s.fileName, err)
+	}
+	return source.Overlapping(store.Events, start, end), nil
+}
+
+// syncFully replaces the store contents with all events overlapping the time between since and until.
+func (s *syncedSource) syncFully(srv *calendar.Service, store *eventStore, since, until time.Time) error {
+	call := srv.Events.List(s.calendarID).SingleEvents(true).
+		TimeMin(since.Format(time.RFC3339)).
+		TimeMax(until.Format(time.RFC3339))
+	events, syncToken, err := listAllPages(call)
+	if err != nil {
+		return fmt.Errorf("unable to retrieve events from calendar %q: %v", s.calendarID, err)
+	}
+	store.Since, store.Until = since, until
+	store.SyncToken = syncToken
+	store.Events = nil
+	store.apply(events)
+	return nil
+}
+
+// syncIncrementally applies changes made since the store was last synced.
+func (s *syncedSource) syncIncrementally(srv *calendar.Service, store *eventStore) error {
+	call := srv.Events.List(s.calendarID).SingleEvents(true).SyncToken(store.SyncToken)
+	changes, syncToken, err := listAllPages(call)
+	if err != nil {
+		return err
+	}
+	store.SyncToken = syncToken
+	store.apply(changes)
+	return nil
+}
+
+// listAllPages returns events from all pages of the listing, and the token for the next incremental sync.
+func listAllPages(call *calendar.EventsListCall) ([]*calendar.Event, string, error) {
+	var allEvents []*calendar.Event
+	call.MaxResults(2500) // maximum page size according to docs
+	for {
+		events, err := call.Do()
+		if err != nil {
+			return nil, "", err
+		}
+		allEvents = append(allEvents, events.Items...)
+		if events.NextPageToken == "" {
+			return allEvents, events.NextSyncToken, nil
+		}
+		call.PageToken(events.NextPageToken)
+	}
+}
+
+func (s *syncedSource) load() (*eventStore, error) {
+	data, err := os.ReadFile(s.fileName)
+	if err != nil {
+		return nil, err
+	}
+	store := &eventStore{}
+	if err = json.Unmarshal(data, store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *syncedSource) save(store *eventStore) error {
+	data, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.fileName), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.fileName, data, 0600)
+}
@@ -0,0 +1,171 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestEventStoreApply(t *testing.T) {
+	store := &eventStore{Events: []*calendar.Event{
+		{Id: "a", Summary: "first"},
+		{Id: "b", Summary: "second"},
+		{Id: "c", Summary: "third"},
+	}}
+	store.apply([]*calendar.Event{
+		{Id: "b", Status: "cancelled"},
+		{Id: "c", Status: "confirmed", Summary: "third, renamed"},
+		{Id: "d", Status: "confirmed", Summary: "fourth"},
+		{Id: "e", Status: "cancelled"},
+	})
+	var got []string
+	for _, e := range store.Events {
+		got = append(got, e.Id+" "+e.Summary)
+	}
+	assert.Equal(t, []string{"a first", "c third, renamed", "d fourth"}, got)
+}
+
+// fakeCalendar serves event listings the way Calendar API does, recording the queries it gets.
+type fakeCalendar struct {
+	// full lists the events returned by a full sync, in pages.
+	full [][]*calendar.Event
+	// changes maps sync tokens to the changes made since they were issued.
+	changes map[string][]*calendar.Event
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+func (f *fakeCalendar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f.mu.Lock()
+	f.queries = append(f.queries, query)
+	f.mu.Unlock()
+	events := &calendar.Events{}
+	if token := query.Get("syncToken"); token != "" {
+		changes, ok := f.changes[token]
+		if !ok {
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"error": {"code": 410, "message": "Sync token is no longer valid, a full sync is required."}}`))
+			return
+		}
+		events.Items = changes
+		events.NextSyncToken = token + "+"
+	} else {
+		page := 0
+		if query.Get("pageToken") != "" {
+			page = 1
+		}
+		events.Items = f.full[page]
+		if page+1 < len(f.full) {
+			events.NextPageToken = "next"
+		} else {
+			events.NextSyncToken = "full"
+		}
+	}
+	json.NewEncoder(w).Encode(events)
+}
+
+func storeEvent(id, summary, start, end string) *calendar.Event {
+	return &calendar.Event{
+		Id:      id,
+		Status:  "confirmed",
+		Summary: summary,
+		Start:   &calendar.EventDateTime{DateTime: start},
+		End:     &calendar.EventDateTime{DateTime: end},
+	}
+}
+
+func TestSyncedSource(t *testing.T) {
+	fake := &fakeCalendar{
+		full: [][]*calendar.Event{
+			{storeEvent("a", "standup", "2023-03-27T09:00:00Z", "2023-03-27T09:15:00Z")},
+			{storeEvent("b", "review", "2023-03-28T10:00:00Z", "2023-03-28T11:00:00Z")},
+		},
+		changes: map[string][]*calendar.Event{
+			"full": {
+				{Id: "a", Status: "cancelled"},
+				storeEvent("c", "planning", "2023-03-29T10:00:00Z", "2023-03-29T11:00:00Z"),
+			},
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	dir := t.TempDir()
+	src := NewSyncedSource(&googleSource{
+		calendarID: "primary",
+		newService: fakeService(server),
+	}, dir)
+	ctx := context.Background()
+	start := time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC)
+
+	// The first sync fetches all pages of events.
+	events, err := src.List(ctx, start, end)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"standup", "review"}, summaries(events))
+	require.Len(t, fake.queries, 2)
+	assert.Equal(t, "2023-03-27T00:00:00Z", fake.queries[0].Get("timeMin"))
+	timeMax, err := time.Parse(time.RFC3339, fake.queries[0].Get("timeMax"))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(storeHorizon), timeMax, time.Minute)
+	assert.Equal(t, "next", fake.queries[1].Get("pageToken"))
+
+	// The next one only applies changes, and saves the new token.
+	events, err = src.List(ctx, start, end)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"review", "planning"}, summaries(events))
+	require.Len(t, fake.queries, 3)
+	assert.Equal(t, "full", fake.queries[2].Get("syncToken"))
+	assert.Empty(t, fake.queries[2].Get("timeMin"))
+	store, err := src.(*syncedSource).load()
+	require.NoError(t, err)
+	assert.Equal(t, "full+", store.SyncToken)
+
+	// An expired token makes it sync fully again.
+	events, err = src.List(ctx, start, end)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"standup", "review"}, summaries(events))
+	require.Len(t, fake.queries, 6)
+	assert.Equal(t, "full+", fake.queries[3].Get("syncToken"))
+	assert.Empty(t, fake.queries[4].Get("syncToken"))
+	store, err = src.(*syncedSource).load()
+	require.NoError(t, err)
+	assert.Equal(t, "full", store.SyncToken)
+
+	// An earlier start than the store covers also makes it sync fully.
+	_, err = src.List(ctx, start.AddDate(0, 0, -7), end)
+	require.NoError(t, err)
+	require.Len(t, fake.queries, 8)
+	assert.Equal(t, "2023-03-20T00:00:00Z", fake.queries[6].Get("timeMin"))
+
+	// So does a later end.
+	later := time.Now().Add(2 * storeHorizon)
+	_, err = src.List(ctx, start, later)
+	require.NoError(t, err)
+	require.Len(t, fake.queries, 10)
+	assert.Equal(t, later.Add(storeHorizon).Format(time.RFC3339), fake.queries[8].Get("timeMax"))
+}
@@ -0,0 +1,73 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package report
+
+import "time"
+
+// Comparison compares time spent per category in another period with the one of the report.
+type Comparison struct {
+	// Start and End delimit the other period.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Total is the time spent in all counted events in the other period.
+	Total Duration `json:"totalSeconds"`
+	// Categories lists changes per configured category, in configuration order, followed by uncategorized time.
+	Categories []CategoryChange `json:"categories"`
+}
+
+// CategoryChange is the change of time spent on a category, from the other period to the one of the report.
+type CategoryChange struct {
+	Name   string `json:"name"`
+	Before Share  `json:"before"`
+	After  Share  `json:"after"`
+	// Change is the time spent after minus the time spent before.
+	Change Duration `json:"changeSeconds"`
+	// PercentChange is Change as a percentage of the time spent before, or nil if no time was spent then.
+	PercentChange *float64 `json:"percentChange"`
+	// Appeared is true if time was spent on the category only after, and Disappeared if only before.
+	Appeared    bool `json:"appeared,omitempty"`
+	Disappeared bool `json:"disappeared,omitempty"`
+}
+
+// Compare adds comparison with the other report, which should be built with the same categories, to this one.
+func (r *Report) Compare(other *Report) {
+	c := &Comparison{Start: other.Start, End: other.End, Total: other.Total, Categories: []CategoryChange{}}
+	before := make(map[string]Share)
+	for _, category := range other.Categories {
+		before[category.Name] = category.Share
+	}
+	for _, category := range r.Categories {
+		c.Categories = append(c.Categories, newCategoryChange(category.Name, before[category.Name], category.Share))
+	}
+	c.Categories = append(c.Categories, newCategoryChange("", other.Uncategorized, r.Uncategorized))
+	r.Comparison = c
+}
+
+func newCategoryChange(name string, before, after Share) CategoryChange {
+	c := CategoryChange{
+		Name:        name,
+		Before:      before,
+		After:       after,
+		Change:      after.Seconds - before.Seconds,
+		Appeared:    before.Seconds == 0 && after.Seconds > 0,
+		Disappeared: before.Seconds > 0 && after.Seconds == 0,
+	}
+	if before.Seconds > 0 {
+		percent := float64(c.Change) / float64(before.Seconds) * 100
+		c.PercentChange = &percent
+	}
+	return c
+}
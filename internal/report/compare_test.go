@@ -0,0 +1,82 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/core"
+	"github.com/porridge/calendar-stats/internal/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	src, err := source.ParseFixture(`
+- summary: read mail
+  start: 2023-03-20T09:00:00Z
+  end: 2023-03-20T10:00:00Z
+- summary: code review
+  start: 2023-03-21T09:00:00Z
+  end: 2023-03-21T10:00:00Z
+- summary: read mail
+  start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T10:30:00Z
+- summary: meeting
+  start: 2023-03-28T09:00:00Z
+  end: 2023-03-28T11:00:00Z
+`)
+	require.NoError(t, err)
+	categories := []*core.Category{
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("read mail")}},
+		{Name: "meetings", Patterns: []*regexp.Regexp{regexp.MustCompile("meeting")}},
+		{Name: "reviews", Patterns: []*regexp.Regexp{regexp.MustCompile("review")}},
+		{Name: "travel", Patterns: []*regexp.Regexp{regexp.MustCompile("flight")}},
+	}
+	build := func(start time.Time) *Report {
+		opts := core.Options{Location: time.UTC, Start: start, End: start.AddDate(0, 0, 7)}
+		return Build(core.Compute(src.Events, categories, opts), categories, opts, Day)
+	}
+	r := build(time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC))
+	r.Compare(build(time.Date(2023, 3, 20, 0, 0, 0, 0, time.UTC)))
+
+	mail := r.Comparison.Categories[0]
+	assert.Equal(t, Duration(30*time.Minute), mail.Change)
+	require.NotNil(t, mail.PercentChange)
+	assert.InDelta(t, 50, *mail.PercentChange, 1e-9)
+	assert.True(t, r.Comparison.Categories[1].Appeared)
+	assert.True(t, r.Comparison.Categories[2].Disappeared)
+	assert.Nil(t, r.Comparison.Categories[3].PercentChange)
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", r, Options{}))
+	assert.Contains(t, out.String(), `Compared with 2023-03-20T00:00:00Z - 2023-03-27T00:00:00Z:
+mail: 1h0m0s (50.0%) -> 1h30m0s (42.9%), +30m0s (+50.0%)
+meetings: 0s (0.0%) -> 2h0m0s (57.1%), +2h0m0s (new)
+reviews: 1h0m0s (50.0%) -> 0s (0.0%), -1h0m0s (gone)
+Total: 2h0m0s -> 3h30m0s, +1h30m0s (+75.0%)
+`)
+
+	out.Reset()
+	require.NoError(t, Render(&out, "json", r, Options{}))
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.EqualValues(t, 7200, got["comparison"].(map[string]any)["totalSeconds"])
+}
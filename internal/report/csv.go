@@ -0,0 +1,85 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// renderCSV writes a day (or other period) by category matrix of hours, with a totals row
+// at the bottom, and an averages row when grouping by a period longer than a day.
+// Hours are always decimal, since that is what spreadsheets understand.
+func renderCSV(w io.Writer, r *Report, _ Options) error {
+	out := csv.NewWriter(w)
+	header := []string{"date"}
+	if len(r.Buckets) > 0 {
+		header[0] = string(r.GroupBy)
+	}
+	for _, category := range r.Categories {
+		header = append(header, category.Name)
+	}
+	header = append(header, "(uncategorized)", "total")
+	if r.Utilization != nil {
+		header = append(header, "expected", "within working hours", "outside working hours", "untracked", "utilization")
+	}
+	if r.Free != nil {
+		header = append(header, "free", "longest free block", "focus windows")
+	}
+	rows := [][]string{header}
+	row := func(label string, a Amounts) []string {
+		row := []string{label}
+		for _, category := range r.Categories {
+			row = append(row, formatHours(time.Duration(a.Categories[category.Name])))
+		}
+		row = append(row, formatHours(time.Duration(a.Uncategorized)), formatHours(time.Duration(a.Seconds)))
+		if u := a.Utilization; u != nil {
+			row = append(row,
+				formatHours(time.Duration(u.Expected)),
+				formatHours(time.Duration(u.Within)),
+				formatHours(time.Duration(u.Outside)),
+				formatHours(time.Duration(u.Untracked)),
+				strconv.FormatFloat(u.Percent, 'f', 1, 64))
+		}
+		if f := a.Free; f != nil {
+			row = append(row, formatHours(time.Duration(f.Seconds)), formatHours(time.Duration(f.Longest)), strconv.Itoa(f.FocusWindows))
+		} else if r.Free != nil {
+			// Free time is not averaged.
+			row = append(row, "", "", "")
+		}
+		return row
+	}
+	if len(r.Buckets) > 0 {
+		for _, b := range r.Buckets {
+			rows = append(rows, row(b.Label, b.Amounts))
+		}
+	} else {
+		for _, day := range r.Days {
+			rows = append(rows, row(day.Date, day.Amounts))
+		}
+	}
+	total := Amounts{Seconds: r.Total, Categories: make(map[string]Duration), Uncategorized: r.Uncategorized.Seconds, Utilization: r.Utilization, Free: r.Free}
+	for _, category := range r.Categories {
+		total.Categories[category.Name] = category.Seconds
+	}
+	rows = append(rows, row("total", total))
+	if r.Average != nil {
+		rows = append(rows, row("average", *r.Average))
+	}
+	return out.WriteAll(rows)
+}
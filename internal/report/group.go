@@ -0,0 +1,184 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package report
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/snabb/isoweek"
+)
+
+// Period is the length of time over which daily totals are summed up.
+type Period string
+
+const (
+	Day     = Period("day")
+	Week    = Period("week")
+	Month   = Period("month")
+	Quarter = Period("quarter")
+)
+
+// Periods returns the names of known periods, from shortest to longest.
+func Periods() []string {
+	return []string{string(Day), string(Week), string(Month), string(Quarter)}
+}
+
+// ParsePeriod returns the period with the given name.
+func ParsePeriod(name string) (Period, error) {
+	for _, p := range Periods() {
+		if p == name {
+			return Period(name), nil
+		}
+	}
+	return "", fmt.Errorf("unknown period %q", name)
+}
+
+// bucketStart returns the first day of the period which contains the given day.
+func (p Period) bucketStart(d civil.Date) civil.Date {
+	switch p {
+	case Week:
+		year, month, day := isoweek.StartDate(isoweek.FromDate(d.Year, d.Month, d.Day))
+		return civil.Date{Year: year, Month: month, Day: day}
+	case Month:
+		return civil.Date{Year: d.Year, Month: d.Month, Day: 1}
+	case Quarter:
+		return civil.Date{Year: d.Year, Month: d.Month - (d.Month-1)%3, Day: 1}
+	default:
+		return d
+	}
+}
+
+// next returns the first day of the period following the one which starts on the given day.
+func (p Period) next(start civil.Date) civil.Date {
+	switch p {
+	case Week:
+		return start.AddDays(7)
+	case Month:
+		return start.AddMonths(1)
+	case Quarter:
+		return start.AddMonths(3)
+	default:
+		return start.AddDays(1)
+	}
+}
+
+// label returns the conventional name of the period which starts on the given day.
+func (p Period) label(start civil.Date) string {
+	switch p {
+	case Week:
+		year, week := isoweek.FromDate(start.Year, start.Month, start.Day)
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case Month:
+		return fmt.Sprintf("%04d-%02d", start.Year, start.Month)
+	case Quarter:
+		return fmt.Sprintf("%04d-Q%d", start.Year, (start.Month-1)/3+1)
+	default:
+		return start.String()
+	}
+}
+
+// group sums up day totals into buckets of the given period covering the report time range,
+// and computes the average bucket. Buckets without any events are included, so that they
+// count towards the average. Days begin and end in the given location, as they do for day totals.
+func (r *Report) group(period Period, location *time.Location) {
+	if len(r.Days) == 0 {
+		return
+	}
+	first, _ := civil.ParseDate(r.Days[0].Date)
+	last, _ := civil.ParseDate(r.Days[len(r.Days)-1].Date)
+	if !r.Start.IsZero() {
+		first = civil.DateOf(r.Start.In(location))
+	}
+	if !r.End.IsZero() {
+		last = civil.DateOf(r.End.Add(-time.Nanosecond).In(location))
+	}
+	byStart := make(map[civil.Date]*Bucket)
+	addBucket := func(start civil.Date) *Bucket {
+		b := &Bucket{
+			Label:   period.label(start),
+			Start:   start.String(),
+			End:     period.next(start).String(),
+			Amounts: Amounts{Categories: make(map[string]Duration)},
+		}
+		if r.Utilization != nil {
+			b.Utilization = &Utilization{}
+		}
+		if r.Free != nil {
+			b.Free = &FreeTime{}
+		}
+		r.Buckets = append(r.Buckets, b)
+		byStart[start] = b
+		return b
+	}
+	for start := period.bucketStart(first); !start.After(last); start = period.next(start) {
+		addBucket(start)
+	}
+	for _, day := range r.Days {
+		date, _ := civil.ParseDate(day.Date)
+		b := byStart[period.bucketStart(date)]
+		if b == nil {
+			// A day outside of the time range should not happen, but its time must not go missing.
+			b = addBucket(period.bucketStart(date))
+		}
+		b.add(day.Amounts)
+	}
+	sort.Slice(r.Buckets, func(i, j int) bool { return r.Buckets[i].Start < r.Buckets[j].Start })
+	if len(r.Buckets) == 0 {
+		// The time range is empty, there is nothing to average.
+		return
+	}
+	average := Amounts{Categories: make(map[string]Duration)}
+	if r.Utilization != nil {
+		average.Utilization = &Utilization{}
+	}
+	for _, b := range r.Buckets {
+		average.add(b.Amounts)
+		if b.Utilization != nil {
+			b.Utilization.setPercent(b.Seconds)
+		}
+	}
+	count := Duration(len(r.Buckets))
+	average.Seconds /= count
+	average.Uncategorized /= count
+	for name := range average.Categories {
+		average.Categories[name] /= count
+	}
+	if u := average.Utilization; u != nil {
+		u.Expected /= count
+		u.Within /= count
+		u.Outside /= count
+		u.Untracked /= count
+		u.setPercent(average.Seconds)
+	}
+	r.Average = &average
+}
+
+func (a *Amounts) add(other Amounts) {
+	a.Seconds += other.Seconds
+	a.Uncategorized += other.Uncategorized
+	for name, d := range other.Categories {
+		a.Categories[name] += d
+	}
+	if a.Utilization != nil && other.Utilization != nil {
+		a.Utilization.add(other.Utilization)
+	}
+	if a.Free != nil && other.Free != nil {
+		a.Free.add(other.Free)
+	}
+}
@@ -0,0 +1,167 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package report
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/porridge/calendar-stats/internal/core"
+	"github.com/porridge/calendar-stats/internal/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriodBuckets(t *testing.T) {
+	tests := []struct {
+		period    Period
+		day       civil.Date
+		wantStart civil.Date
+		wantNext  civil.Date
+		wantLabel string
+	}{
+		{Day, civil.Date{Year: 2023, Month: 3, Day: 29}, civil.Date{Year: 2023, Month: 3, Day: 29}, civil.Date{Year: 2023, Month: 3, Day: 30}, "2023-03-29"},
+		{Week, civil.Date{Year: 2023, Month: 3, Day: 29}, civil.Date{Year: 2023, Month: 3, Day: 27}, civil.Date{Year: 2023, Month: 4, Day: 3}, "2023-W13"},
+		{Week, civil.Date{Year: 2021, Month: 1, Day: 1}, civil.Date{Year: 2020, Month: 12, Day: 28}, civil.Date{Year: 2021, Month: 1, Day: 4}, "2020-W53"},
+		{Month, civil.Date{Year: 2023, Month: 12, Day: 31}, civil.Date{Year: 2023, Month: 12, Day: 1}, civil.Date{Year: 2024, Month: 1, Day: 1}, "2023-12"},
+		{Quarter, civil.Date{Year: 2023, Month: 6, Day: 30}, civil.Date{Year: 2023, Month: 4, Day: 1}, civil.Date{Year: 2023, Month: 7, Day: 1}, "2023-Q2"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.period)+" "+tt.day.String(), func(t *testing.T) {
+			start := tt.period.bucketStart(tt.day)
+			assert.Equal(t, tt.wantStart, start)
+			assert.Equal(t, tt.wantNext, tt.period.next(start))
+			assert.Equal(t, tt.wantLabel, tt.period.label(start))
+		})
+	}
+}
+
+func TestGroupByWeek(t *testing.T) {
+	src, err := source.ParseFixture(`
+- summary: read mail
+  start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T10:00:00Z
+- summary: meeting
+  start: 2023-03-29T09:00:00Z
+  end: 2023-03-29T11:00:00Z
+- summary: meeting
+  start: 2023-04-04T09:00:00Z
+  end: 2023-04-04T09:30:00Z
+- summary: lunch
+  start: 2023-04-04T12:00:00Z
+  end: 2023-04-04T12:30:00Z
+`)
+	require.NoError(t, err)
+	categories := []*core.Category{
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("read mail")}},
+		{Name: "meetings", Patterns: []*regexp.Regexp{regexp.MustCompile("meeting")}},
+	}
+	opts := core.Options{
+		Location: time.UTC,
+		Start:    time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 4, 17, 0, 0, 0, 0, time.UTC),
+	}
+	r := Build(core.Compute(src.Events, categories, opts), categories, opts, Week)
+
+	var labels []string
+	for _, b := range r.Buckets {
+		labels = append(labels, b.Label)
+	}
+	assert.Equal(t, []string{"2023-W13", "2023-W14", "2023-W15"}, labels)
+	assert.Equal(t, Duration(3*time.Hour), r.Buckets[0].Seconds)
+	assert.Equal(t, Duration(0), r.Buckets[2].Seconds)
+	assert.Equal(t, Duration(80*time.Minute), r.Average.Seconds)
+	assert.Equal(t, Duration(50*time.Minute), r.Average.Categories["meetings"])
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", r, Options{}))
+	assert.Contains(t, out.String(), `Time spent per week:
+2023-W13: 3h0m0s
+  mail: 1h0m0s
+  meetings: 2h0m0s
+  (uncategorized): 0s
+2023-W14: 1h0m0s
+  mail: 0s
+  meetings: 30m0s
+  (uncategorized): 30m0s
+2023-W15: 0s
+  mail: 0s
+  meetings: 0s
+  (uncategorized): 0s
+Average per week: 1h20m0s
+  mail: 20m0s
+  meetings: 50m0s
+  (uncategorized): 10m0s
+Time spent per category:
+`)
+
+	out.Reset()
+	require.NoError(t, Render(&out, "csv", r, Options{}))
+	assert.Equal(t, `week,mail,meetings,(uncategorized),total
+2023-W13,1.000000,2.000000,0.000000,3.000000
+2023-W14,0.000000,0.500000,0.500000,1.000000
+2023-W15,0.000000,0.000000,0.000000,0.000000
+total,1.000000,2.500000,0.500000,4.000000
+average,0.333333,0.833333,0.166667,1.333333
+`, out.String())
+}
+
+func TestGroupEmptyTimeRange(t *testing.T) {
+	r := &Report{
+		Start: time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		Days:  []DayTotal{{Date: "2023-03-28", Amounts: Amounts{Seconds: Duration(time.Hour)}}},
+	}
+	r.group(Week, time.UTC)
+	// The day falls outside of the empty time range, but still gets a bucket.
+	require.Len(t, r.Buckets, 1)
+	assert.Equal(t, "2023-W13", r.Buckets[0].Label)
+	assert.Equal(t, Duration(time.Hour), r.Average.Seconds)
+
+	for _, format := range []string{"text", "json", "csv"} {
+		require.NoError(t, Render(&bytes.Buffer{}, format, r, Options{}), format)
+	}
+}
+
+func TestGroupInLocation(t *testing.T) {
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	require.NoError(t, err)
+	src, err := source.ParseFixture(`
+- summary: read mail
+  start: 2023-03-27T08:00:00+02:00
+  end: 2023-03-27T10:00:00+02:00
+- summary: read mail
+  start: 2023-04-02T20:00:00+02:00
+  end: 2023-04-02T21:00:00+02:00
+`)
+	require.NoError(t, err)
+	categories := []*core.Category{{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("read mail")}}}
+	// Bounds parsed from the command line are in UTC, and fall on the previous day there.
+	opts := core.Options{
+		Location: warsaw,
+		Start:    time.Date(2023, 3, 26, 22, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 4, 2, 22, 0, 0, 0, time.UTC),
+	}
+	r := Build(core.Compute(src.Events, categories, opts), categories, opts, Week)
+
+	require.Len(t, r.Buckets, 1)
+	assert.Equal(t, "2023-W13", r.Buckets[0].Label)
+	assert.Equal(t, Duration(3*time.Hour), r.Buckets[0].Seconds)
+	assert.Equal(t, r.Total, r.Average.Seconds)
+}
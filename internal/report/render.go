@@ -0,0 +1,65 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Options control how reports are rendered. Renderers use the ones relevant to them.
+type Options struct {
+	// DecimalOutput requests durations as decimal fractions of hours.
+	DecimalOutput bool
+	// ShowCalendars requests the calendar of each listed event to be shown.
+	ShowCalendars bool
+}
+
+// Renderer writes a report in some format.
+type Renderer func(w io.Writer, r *Report, opts Options) error
+
+var renderers = map[string]Renderer{
+	"text": renderText,
+	"json": renderJSON,
+	"csv":  renderCSV,
+}
+
+// Formats returns the names of known formats, in alphabetical order.
+func Formats() []string {
+	var formats []string
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Render writes the report to w in the given format.
+func Render(w io.Writer, format string, r *Report, opts Options) error {
+	renderer, ok := renderers[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	return renderer(w, r, opts)
+}
+
+func renderJSON(w io.Writer, r *Report, _ Options) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,532 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package report builds reports out of accounting results, and renders them in various formats.
+package report
+
+import (
+	"encoding/json"
+	"maps"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/porridge/calendar-stats/internal/core"
+	"github.com/porridge/calendar-stats/internal/ordererd"
+	"github.com/porridge/calendar-stats/internal/source"
+	"google.golang.org/api/calendar/v3"
+)
+
+// SchemaVersion is the version of the JSON representation of Report.
+// It changes whenever a field is removed or changes meaning; new fields may be added without changing it.
+const SchemaVersion = 1
+
+// Duration is represented in JSON as a (possibly fractional) number of seconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).Seconds())
+}
+
+// Report holds everything there is to say about the analyzed time range.
+// Its JSON representation is documented in README.md.
+type Report struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	// Total is the time spent in all counted events.
+	Total Duration `json:"totalSeconds"`
+	// Utilization compares Total with the expected working time, if there is a working hours schedule.
+	Utilization *Utilization `json:"utilization,omitempty"`
+	// Free is the working time in which no event was counted, if there is a working hours schedule.
+	Free *FreeTime `json:"free,omitempty"`
+	// Switching is the total of switching between categories over all days, if requested.
+	Switching *Switching `json:"switching,omitempty"`
+	// Meetings splits time by who else attended the events, if requested.
+	Meetings *Meetings `json:"meetings,omitempty"`
+	// Series lists recurring events from the most to the least time spent in them, if requested.
+	Series []Series `json:"series,omitempty"`
+	// Comparison compares time spent per category with another period, if requested.
+	Comparison *Comparison `json:"comparison,omitempty"`
+	// FocusBlock is the shortest free block which counts as a focus window.
+	FocusBlock Duration `json:"focusBlockSeconds,omitempty"`
+	// FocusWindows lists free blocks at least FocusBlock long, in chronological order.
+	FocusWindows []Window `json:"focusWindows,omitempty"`
+	// Days lists time spent per day, in chronological order.
+	// With a working hours schedule, it includes days on which work was expected, even if no time was spent.
+	Days []DayTotal `json:"days"`
+	// GroupBy is the period over which Buckets sum up days.
+	GroupBy Period `json:"groupBy"`
+	// Buckets lists time spent per period, in chronological order. It is empty when grouping by day.
+	Buckets []*Bucket `json:"buckets,omitempty"`
+	// Average is the average of Buckets, or nil when grouping by day.
+	Average *Amounts `json:"average,omitempty"`
+	// Categories lists time spent per configured category, in configuration order.
+	Categories []CategoryTotal `json:"categories"`
+	// Tree lists top-level categories, with time spent in each including its descendants.
+	Tree []*CategoryNode `json:"tree"`
+	// Uncategorized is the time spent in events which do not belong to any category.
+	Uncategorized Share `json:"uncategorized"`
+	// Dimensions lists time spent per tag in each configured dimension, in configuration order.
+	Dimensions []DimensionTotal `json:"dimensions"`
+	// Tags lists time spent per inline tag, from the most to the least time.
+	// Percentages may add up to more than 100, since an event may have several tags.
+	Tags []CategoryTotal `json:"tags"`
+	// Unrecognized lists events which do not belong to any category.
+	Unrecognized []Event `json:"unrecognized"`
+	// Explanations tell what happened to each event, if requested.
+	Explanations []Explanation `json:"explanations,omitempty"`
+}
+
+// Amounts is time spent in some period, in total and split between categories.
+type Amounts struct {
+	Seconds Duration `json:"seconds"`
+	// Categories maps names of configured categories to time spent on them.
+	Categories map[string]Duration `json:"categories"`
+	// Uncategorized is the time spent in events which do not belong to any category.
+	Uncategorized Duration `json:"uncategorizedSeconds"`
+	// Utilization compares Seconds with the expected working time, if there is a working hours schedule.
+	Utilization *Utilization `json:"utilization,omitempty"`
+	// Free is the working time in which no event was counted, if there is a working hours schedule.
+	// It is not averaged.
+	Free *FreeTime `json:"free,omitempty"`
+}
+
+// FreeTime describes working time in which no event was counted.
+type FreeTime struct {
+	Seconds Duration `json:"seconds"`
+	// Longest is the length of the longest uninterrupted free block.
+	Longest Duration `json:"longestSeconds"`
+	// FocusWindows is the number of free blocks at least as long as the focus block.
+	FocusWindows int `json:"focusWindows"`
+}
+
+func (f *FreeTime) add(other *FreeTime) {
+	f.Seconds += other.Seconds
+	f.Longest = max(f.Longest, other.Longest)
+	f.FocusWindows += other.FocusWindows
+}
+
+// Window is an uninterrupted block of time.
+type Window struct {
+	// Start and End are RFC 3339 times.
+	Start   string   `json:"start"`
+	End     string   `json:"end"`
+	Seconds Duration `json:"seconds"`
+}
+
+// Utilization compares time spent in events with the working time expected by the schedule.
+type Utilization struct {
+	// Expected is the working time.
+	Expected Duration `json:"expectedSeconds"`
+	// Within and Outside split time spent in events into the parts within and outside working hours.
+	Within  Duration `json:"withinHoursSeconds"`
+	Outside Duration `json:"outsideHoursSeconds"`
+	// Untracked is the working time which was not spent in any event.
+	Untracked Duration `json:"untrackedSeconds"`
+	// Percent is the time spent in events as a share of Expected, or 0 if no time was expected.
+	Percent float64 `json:"percent"`
+}
+
+func newUtilization(spent, expected, within time.Duration) *Utilization {
+	u := &Utilization{
+		Expected:  Duration(expected),
+		Within:    Duration(within),
+		Outside:   Duration(spent - within),
+		Untracked: Duration(max(expected-within, 0)),
+	}
+	u.setPercent(Duration(spent))
+	return u
+}
+
+// add adds the other utilization to this one, except for Percent, which needs to be set afterwards.
+func (u *Utilization) add(other *Utilization) {
+	u.Expected += other.Expected
+	u.Within += other.Within
+	u.Outside += other.Outside
+	u.Untracked += other.Untracked
+}
+
+func (u *Utilization) setPercent(spent Duration) {
+	u.Percent = 0
+	if u.Expected > 0 {
+		u.Percent = float64(spent) / float64(u.Expected) * 100
+	}
+}
+
+type DayTotal struct {
+	Date string `json:"date"`
+	Amounts
+	// Switching is only present if requested.
+	Switching *Switching `json:"switching,omitempty"`
+}
+
+// Meetings tells how time spent in events splits by who else attended them.
+type Meetings struct {
+	// OneOnOne and Group are the time spent in meetings with one other attendee, and with more.
+	// Alone is the time spent in events without other attendees.
+	OneOnOne Share `json:"oneOnOne"`
+	Group    Share `json:"group"`
+	Alone    Share `json:"alone"`
+	// Sizes lists time spent per meeting size, from the smallest, as named by core.MeetingSizes.
+	Sizes []CategoryTotal `json:"sizes"`
+	// Organizers lists time spent in events organized by other people, from the most to the least.
+	Organizers []CategoryTotal `json:"organizers"`
+	// ExternalDomains lists time spent in meetings with people from outside of your organization, per domain,
+	// from the most to the least. Percentages may add up to more than 100, since a meeting may have
+	// attendees from several domains.
+	ExternalDomains []CategoryTotal `json:"externalDomains"`
+}
+
+// AddMeetings adds statistics of meeting sizes, organizers and external participants to the report.
+func (r *Report) AddMeetings(totals *core.Totals) {
+	share := func(d time.Duration) Share {
+		return newShare(d, time.Duration(r.Total))
+	}
+	m := &Meetings{Sizes: []CategoryTotal{}}
+	var group time.Duration
+	for _, size := range core.MeetingSizes {
+		d := totals.Meetings.Sizes[size]
+		m.Sizes = append(m.Sizes, CategoryTotal{Name: size, Share: share(d)})
+		if size != core.Alone && size != core.OneOnOne {
+			group += d
+		}
+	}
+	m.OneOnOne = share(totals.Meetings.Sizes[core.OneOnOne])
+	m.Group = share(group)
+	m.Alone = share(totals.Meetings.Sizes[core.Alone])
+	m.Organizers = byTime(totals.Meetings.Organizers, share)
+	m.ExternalDomains = byTime(totals.Meetings.ExternalDomains, share)
+	r.Meetings = m
+}
+
+// Series is time spent in instances of a recurring event.
+type Series struct {
+	// ID is the ID of the recurring event.
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+	Share
+	// Attended and Declined count instances which were counted, and ones which you declined.
+	Attended int `json:"attended"`
+	Declined int `json:"declined"`
+	// Average is the average time spent in an attended instance.
+	Average Duration `json:"averageSeconds"`
+}
+
+// AddSeries adds time spent per recurring event to the report, from the most to the least.
+func (r *Report) AddSeries(totals *core.Totals) {
+	r.Series = []Series{}
+	for id, s := range totals.Series {
+		r.Series = append(r.Series, Series{
+			ID:       id,
+			Summary:  s.Summary,
+			Share:    newShare(s.Time, time.Duration(r.Total)),
+			Attended: s.Attended,
+			Declined: s.Declined,
+			Average:  Duration(s.AverageDuration()),
+		})
+	}
+	sort.Slice(r.Series, func(i, j int) bool {
+		if r.Series[i].Seconds != r.Series[j].Seconds {
+			return r.Series[i].Seconds > r.Series[j].Seconds
+		}
+		if r.Series[i].Summary != r.Series[j].Summary {
+			return r.Series[i].Summary < r.Series[j].Summary
+		}
+		return r.Series[i].ID < r.Series[j].ID
+	})
+}
+
+// Switching tells how often the categories of running events changed.
+type Switching struct {
+	Switches int `json:"switches"`
+	// AverageStretch is the average length of continuous stretches of time spent on the same categories.
+	AverageStretch Duration `json:"averageStretchSeconds"`
+	// Fragmentation is the number of switches per hour of time spent.
+	Fragmentation float64 `json:"fragmentation"`
+	// Choppy is true for days which exceed any of the configured thresholds.
+	Choppy bool `json:"choppy,omitempty"`
+}
+
+func newSwitching(s *core.Switching) *Switching {
+	return &Switching{
+		Switches:       s.Switches,
+		AverageStretch: Duration(s.AverageStretch()),
+		Fragmentation:  s.Fragmentation(),
+	}
+}
+
+// AddSwitching adds statistics of switching between categories per day and in total to the report,
+// flagging days which exceed the thresholds as choppy.
+func (r *Report) AddSwitching(totals *core.Totals, thresholds core.SwitchingThresholds) {
+	var total core.Switching
+	for i := range r.Days {
+		date, _ := civil.ParseDate(r.Days[i].Date)
+		s := totals.Switching[date]
+		if s == nil {
+			s = &core.Switching{}
+		}
+		total.Add(s)
+		r.Days[i].Switching = newSwitching(s)
+		r.Days[i].Switching.Choppy = thresholds.Exceeded(s)
+	}
+	r.Switching = newSwitching(&total)
+}
+
+// Bucket is time spent in a week, month or quarter.
+type Bucket struct {
+	// Label names the period, for example "2023-W13", "2023-03" or "2023-Q1".
+	Label string `json:"label"`
+	// Start and End are the first day of the period and the first day after it.
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Amounts
+}
+
+// Share is some part of the total time.
+type Share struct {
+	Seconds Duration `json:"seconds"`
+	// Percent is the share of total time, between 0 and 100.
+	Percent float64 `json:"percent"`
+}
+
+// newShare returns the share of d in total, which is zero if total is.
+func newShare(d, total time.Duration) Share {
+	s := Share{Seconds: Duration(d)}
+	if total > 0 {
+		s.Percent = float64(d) / float64(total) * 100
+	}
+	return s
+}
+
+type CategoryTotal struct {
+	Name string `json:"name"`
+	Share
+}
+
+type DimensionTotal struct {
+	Name string `json:"name"`
+	// Tags lists time spent per tag, in configuration order.
+	Tags []CategoryTotal `json:"tags"`
+	// Untagged is the time spent in events which have no tag in this dimension.
+	Untagged Share `json:"untagged"`
+}
+
+// CategoryNode is a category in the tree of nested categories.
+type CategoryNode struct {
+	// Name is the full name of the category, including names of its ancestors.
+	Name string `json:"name"`
+	// Share is the time spent in the category and its descendants.
+	Share
+	Children []*CategoryNode `json:"children,omitempty"`
+}
+
+type Event struct {
+	ID       string `json:"id"`
+	Calendar string `json:"calendar,omitempty"`
+	// Start is the RFC 3339 start time of the event, as scheduled, or its date for all-day events.
+	Start string `json:"start"`
+	// Seconds is the scheduled duration of the event.
+	Seconds Duration `json:"seconds"`
+	Summary string   `json:"summary"`
+}
+
+// findFree sums up free blocks per day, and lists those long enough to be focus windows.
+func (r *Report) findFree(blocks []core.Block, opts core.Options) map[civil.Date]*FreeTime {
+	r.Free = &FreeTime{}
+	r.FocusBlock = Duration(opts.FocusBlock)
+	r.FocusWindows = []Window{}
+	ret := make(map[civil.Date]*FreeTime)
+	for _, b := range blocks {
+		day := civil.DateOf(b.Start.In(opts.Location))
+		f := ret[day]
+		if f == nil {
+			f = &FreeTime{}
+			ret[day] = f
+		}
+		one := &FreeTime{Seconds: Duration(b.Duration()), Longest: Duration(b.Duration())}
+		if b.Duration() >= opts.FocusBlock {
+			one.FocusWindows = 1
+			r.FocusWindows = append(r.FocusWindows, Window{
+				Start:   b.Start.In(opts.Location).Format(time.RFC3339),
+				End:     b.End.In(opts.Location).Format(time.RFC3339),
+				Seconds: Duration(b.Duration()),
+			})
+		}
+		f.add(one)
+	}
+	return ret
+}
+
+// byTime lists the amounts of time, from the most to the least, and then by name.
+func byTime(amounts map[string]time.Duration, share func(time.Duration) Share) []CategoryTotal {
+	ret := []CategoryTotal{}
+	for name, d := range amounts {
+		ret = append(ret, CategoryTotal{Name: name, Share: share(d)})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Seconds != ret[j].Seconds {
+			return ret[i].Seconds > ret[j].Seconds
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// Build makes a report out of the given totals, computed with the given categories and options.
+// Day totals are additionally summed up over the given period, unless it is Day.
+func Build(totals *core.Totals, categories []*core.Category, opts core.Options, groupBy Period) *Report {
+	r := &Report{
+		SchemaVersion: SchemaVersion,
+		Start:         opts.Start,
+		End:           opts.End,
+		GroupBy:       groupBy,
+		Days:          []DayTotal{},
+		Categories:    []CategoryTotal{},
+		Tree:          []*CategoryNode{},
+		Dimensions:    []DimensionTotal{},
+		Tags:          []CategoryTotal{},
+		Unrecognized:  []Event{},
+	}
+	var total time.Duration
+	days := totals.Days
+	var free map[civil.Date]*FreeTime
+	if opts.Schedule != nil {
+		free = r.findFree(totals.Free, opts)
+		r.Utilization = &Utilization{}
+		days = maps.Clone(totals.Days)
+		for day := range totals.Expected {
+			days[day] += 0
+		}
+	}
+	for _, day := range ordererd.KeysOfMap(days, ordererd.CivilDates) {
+		total += totals.Days[day]
+		dayTotal := DayTotal{
+			Date: day.String(),
+			Amounts: Amounts{
+				Seconds:       Duration(totals.Days[day]),
+				Categories:    make(map[string]Duration),
+				Uncategorized: Duration(totals.DayCategories[day][core.Uncategorized]),
+			},
+		}
+		for _, category := range categories {
+			dayTotal.Categories[string(category.Name)] = Duration(totals.DayCategories[day][category.Name])
+		}
+		if opts.Schedule != nil {
+			dayTotal.Utilization = newUtilization(totals.Days[day], totals.Expected[day], totals.WithinHours[day])
+			r.Utilization.add(dayTotal.Utilization)
+			dayTotal.Free = &FreeTime{}
+			if f := free[day]; f != nil {
+				dayTotal.Free = f
+			}
+			r.Free.add(dayTotal.Free)
+		}
+		r.Days = append(r.Days, dayTotal)
+	}
+	r.Total = Duration(total)
+	if r.Utilization != nil {
+		r.Utilization.setPercent(r.Total)
+	}
+	share := func(d time.Duration) Share {
+		return newShare(d, total)
+	}
+	for _, category := range categories {
+		r.Categories = append(r.Categories, CategoryTotal{Name: string(category.Name), Share: share(totals.Categories[category.Name])})
+	}
+	r.Uncategorized = share(totals.Categories[core.Uncategorized])
+	nodes := make(map[core.CategoryName]*CategoryNode)
+	var addNode func(name core.CategoryName) *CategoryNode
+	addNode = func(name core.CategoryName) *CategoryNode {
+		if node, ok := nodes[name]; ok {
+			return node
+		}
+		node := &CategoryNode{Name: string(name), Share: share(totals.Subtrees[name])}
+		nodes[name] = node
+		if parent := name.Parent(); parent != core.Uncategorized {
+			parentNode := addNode(parent)
+			parentNode.Children = append(parentNode.Children, node)
+		} else {
+			r.Tree = append(r.Tree, node)
+		}
+		return node
+	}
+	for _, category := range categories {
+		addNode(category.Name)
+	}
+	for _, d := range opts.Dimensions {
+		dimensionTotal := DimensionTotal{Name: d.Name, Tags: []CategoryTotal{}, Untagged: share(totals.Dimensions[d.Name][core.Untagged])}
+		for _, tag := range d.Tags {
+			dimensionTotal.Tags = append(dimensionTotal.Tags, CategoryTotal{Name: string(tag.Name), Share: share(totals.Dimensions[d.Name][tag.Name])})
+		}
+		r.Dimensions = append(r.Dimensions, dimensionTotal)
+	}
+	r.Tags = byTime(totals.Tags, share)
+	for _, e := range totals.Unrecognized {
+		r.Unrecognized = append(r.Unrecognized, newEvent(e))
+	}
+	if groupBy != Day {
+		r.group(groupBy, opts.Location)
+	}
+	return r
+}
+
+func newEvent(e *calendar.Event) Event {
+	ret := Event{ID: e.Id, Calendar: source.CalendarOf(e), Summary: e.Summary}
+	start, end, ok := source.Times(e)
+	if !ok {
+		return ret
+	}
+	ret.Start = e.Start.DateTime
+	if ret.Start == "" {
+		ret.Start = e.Start.Date
+	}
+	ret.Seconds = Duration(end.Sub(start))
+	return ret
+}
+
+// Explanation tells what happened to an event.
+type Explanation struct {
+	Event
+	// Excluded is the reason for not counting the event, or empty if it was counted.
+	Excluded string `json:"excluded,omitempty"`
+	// CountedStart and CountedEnd are the RFC 3339 times the event was counted between,
+	// after stretching and clipping to the time range.
+	CountedStart string `json:"countedStart,omitempty"`
+	CountedEnd   string `json:"countedEnd,omitempty"`
+	// Fixed is the time counted for an all-day or out of office event counted by the all_day rule,
+	// regardless of the time between CountedStart and CountedEnd.
+	Fixed Duration `json:"fixedSeconds,omitempty"`
+	// Category is the category of a counted event, empty if it has none.
+	Category string `json:"category,omitempty"`
+	// Rule describes the pattern or rule which put the event in its category.
+	Rule string `json:"rule,omitempty"`
+}
+
+// Explain adds explanations of what happened to each event to the report.
+func (r *Report) Explain(explanations []core.Explanation) {
+	r.Explanations = []Explanation{}
+	for _, e := range explanations {
+		ex := Explanation{Event: newEvent(e.Event), Excluded: string(e.Excluded)}
+		if e.Excluded == "" {
+			ex.CountedStart = e.Start.Format(time.RFC3339)
+			ex.CountedEnd = e.End.Format(time.RFC3339)
+			ex.Fixed = Duration(e.Fixed)
+			ex.Category = string(e.Category)
+			ex.Rule = e.Rule
+		}
+		r.Explanations = append(r.Explanations, ex)
+	}
+}
@@ -0,0 +1,409 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/porridge/calendar-stats/internal/core"
+	"github.com/porridge/calendar-stats/internal/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fixture = `
+- summary: read mail
+  start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T10:00:00Z
+- summary: meeting
+  start: 2023-03-28T09:00:00Z
+  end: 2023-03-28T11:00:00Z
+- summary: reaad mail
+  id: typo
+  start: 2023-03-28T12:00:00Z
+  end: 2023-03-28T12:15:00Z
+`
+
+func buildReport(t *testing.T) *Report {
+	t.Helper()
+	src, err := source.ParseFixture(fixture)
+	require.NoError(t, err)
+	categories := []*core.Category{
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("read mail")}},
+		{Name: "meetings", Patterns: []*regexp.Regexp{regexp.MustCompile("meeting")}},
+	}
+	opts := core.Options{
+		Location: time.UTC,
+		Start:    time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC),
+	}
+	return Build(core.Compute(src.Events, categories, opts), categories, opts, Day)
+}
+
+func TestRenderText(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", buildReport(t), Options{}))
+	assert.Equal(t, `Time spent per day:
+2023-03-27: 1h0m0s
+2023-03-28: 2h15m0s
+Time spent per category:
+30.8% mail
+61.5% meetings
+Unrecognized:
+2023-03-28T12:00:00Z      15m0s  reaad mail
+`, out.String())
+}
+
+func TestRenderJSON(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "json", buildReport(t), Options{}))
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.EqualValues(t, SchemaVersion, got["schemaVersion"])
+	assert.Equal(t, "2023-03-27T00:00:00Z", got["start"])
+	assert.EqualValues(t, 3*3600+15*60, got["totalSeconds"])
+	assert.Equal(t, []any{
+		map[string]any{
+			"date":                 "2023-03-27",
+			"seconds":              3600.0,
+			"categories":           map[string]any{"mail": 3600.0, "meetings": 0.0},
+			"uncategorizedSeconds": 0.0,
+		},
+		map[string]any{
+			"date":                 "2023-03-28",
+			"seconds":              8100.0,
+			"categories":           map[string]any{"mail": 0.0, "meetings": 7200.0},
+			"uncategorizedSeconds": 900.0,
+		},
+	}, got["days"])
+	categories := got["categories"].([]any)
+	require.Len(t, categories, 2)
+	assert.Equal(t, "meetings", categories[1].(map[string]any)["name"])
+	assert.EqualValues(t, 7200, categories[1].(map[string]any)["seconds"])
+	assert.EqualValues(t, 900, got["uncategorized"].(map[string]any)["seconds"])
+	assert.Equal(t, []any{map[string]any{
+		"id":      "typo",
+		"start":   "2023-03-28T12:00:00Z",
+		"seconds": 900.0,
+		"summary": "reaad mail",
+	}}, got["unrecognized"])
+}
+
+func TestRenderJSONNoEvents(t *testing.T) {
+	categories := []*core.Category{{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("read mail")}}}
+	opts := core.Options{
+		Location: time.UTC,
+		Start:    time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC),
+	}
+	totals := core.Compute(nil, categories, opts)
+	r := Build(totals, categories, opts, Day)
+	r.AddMeetings(totals)
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "json", r, Options{}))
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.EqualValues(t, 0, got["totalSeconds"])
+	assert.Equal(t, []any{map[string]any{"name": "mail", "seconds": 0.0, "percent": 0.0}}, got["categories"])
+	assert.Equal(t, map[string]any{"seconds": 0.0, "percent": 0.0}, got["meetings"].(map[string]any)["group"])
+}
+
+func TestRenderCSV(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "csv", buildReport(t), Options{}))
+	assert.Equal(t, `date,mail,meetings,(uncategorized),total
+2023-03-27,1.000000,0.000000,0.000000,1.000000
+2023-03-28,0.000000,2.000000,0.250000,2.250000
+total,1.000000,2.000000,0.250000,3.250000
+`, out.String())
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	assert.Error(t, Render(&bytes.Buffer{}, "xml", buildReport(t), Options{}))
+}
+
+func TestRenderTree(t *testing.T) {
+	src, err := source.ParseFixture(`
+- summary: design review
+  start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T10:00:00Z
+- summary: page
+  start: 2023-03-27T10:00:00Z
+  end: 2023-03-27T11:00:00Z
+- summary: read mail
+  start: 2023-03-27T11:00:00Z
+  end: 2023-03-27T13:00:00Z
+`)
+	require.NoError(t, err)
+	categories := []*core.Category{
+		{Name: "engineering/reviews", Patterns: []*regexp.Regexp{regexp.MustCompile("review")}},
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("mail")}},
+		{Name: "engineering/oncall", Patterns: []*regexp.Regexp{regexp.MustCompile("page")}},
+	}
+	opts := core.Options{Location: time.UTC}
+	r := Build(core.Compute(src.Events, categories, opts), categories, opts, Day)
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", r, Options{}))
+	assert.Contains(t, out.String(), `Time spent per category:
+50.0% engineering
+  25.0% reviews
+  25.0% oncall
+50.0% mail
+`)
+}
+
+func TestRenderDimensions(t *testing.T) {
+	src, err := source.ParseFixture(fixture)
+	require.NoError(t, err)
+	opts := core.Options{
+		Location: time.UTC,
+		Dimensions: []*core.Dimension{{Name: "project", Tags: []*core.Category{
+			{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("mail")}},
+		}}},
+	}
+	r := Build(core.Compute(src.Events, nil, opts), nil, opts, Day)
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", r, Options{}))
+	assert.Equal(t, `Time spent per day:
+2023-03-27: 1h0m0s
+2023-03-28: 2h15m0s
+Time spent per project:
+38.5% mail
+61.5% (untagged)
+`, out.String())
+}
+
+func TestRenderExplanations(t *testing.T) {
+	src, err := source.ParseFixture(`
+- summary: read mail
+  id: mail
+  start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T09:25:00Z
+- summary: lunch
+  start: 2023-03-27T12:00:00Z
+  end: 2023-03-27T13:00:00Z
+  response: declined
+- summary: conference
+  date: 2023-03-28
+`)
+	require.NoError(t, err)
+	categories := []*core.Category{
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("mail")}},
+	}
+	opts := core.Options{Location: time.UTC, Stretch: core.DefaultStretchRules}
+	r := Build(core.Compute(src.Events, categories, opts), categories, opts, Day)
+	r.Explain(core.Explain(src.Events, categories, opts))
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", r, Options{}))
+	assert.Contains(t, out.String(), `Counted events:
+2023-03-27T09:00:00Z - 2023-03-27T09:30:00Z (scheduled 25m0s)  read mail  => mail by pattern "mail"
+Excluded events:
+2023-03-27T12:00:00Z  declined  lunch
+2023-03-28  all-day  conference
+`)
+
+	out.Reset()
+	require.NoError(t, Render(&out, "json", r, Options{}))
+	var got struct{ Explanations []map[string]any }
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	require.Len(t, got.Explanations, 3)
+	assert.Equal(t, map[string]any{
+		"id":           "mail",
+		"start":        "2023-03-27T09:00:00Z",
+		"seconds":      1500.0,
+		"summary":      "read mail",
+		"countedStart": "2023-03-27T09:00:00Z",
+		"countedEnd":   "2023-03-27T09:30:00Z",
+		"category":     "mail",
+		"rule":         `pattern "mail"`,
+	}, got.Explanations[0])
+	assert.Equal(t, "all-day", got.Explanations[2]["excluded"])
+}
+
+func TestRenderUtilization(t *testing.T) {
+	src, err := source.ParseFixture(fixture + `
+- summary: read mail
+  start: 2023-03-28T17:00:00Z
+  end: 2023-03-28T18:00:00Z
+`)
+	require.NoError(t, err)
+	hours := []core.TimeRange{{Start: civil.Time{Hour: 9}, End: civil.Time{Hour: 17}}}
+	opts := core.Options{
+		Location: time.UTC,
+		Start:    time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 4, 3, 0, 0, 0, 0, time.UTC),
+		Schedule: &core.Schedule{
+			Location: time.UTC,
+			Hours:    map[time.Weekday][]core.TimeRange{time.Monday: hours, time.Tuesday: hours, time.Wednesday: hours},
+		},
+		FocusBlock: 2 * time.Hour,
+	}
+	totals := core.Compute(src.Events, nil, opts)
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", Build(totals, nil, opts, Day), Options{}))
+	assert.Equal(t, `Time spent per day:
+2023-03-27: 1h0m0s  (12.5% of 8h0m0s expected, 7h0m0s untracked)
+2023-03-28: 3h15m0s  (40.6% of 8h0m0s expected, 5h45m0s untracked, 1h0m0s outside working hours)
+2023-03-29: 0s  (0.0% of 8h0m0s expected, 8h0m0s untracked)
+Total: 4h15m0s  (17.7% of 24h0m0s expected, 20h45m0s untracked, 1h0m0s outside working hours)
+Free working time per day:
+2023-03-27: 7h0m0s free, longest block 7h0m0s, 1 focus window
+2023-03-28: 5h45m0s free, longest block 4h45m0s, 1 focus window
+2023-03-29: 8h0m0s free, longest block 8h0m0s, 1 focus window
+Total: 20h45m0s free, longest block 8h0m0s, 3 focus windows
+Focus windows of at least 2h0m0s:
+2023-03-27T10:00:00Z - 2023-03-27T17:00:00Z  7h0m0s
+2023-03-28T12:15:00Z - 2023-03-28T17:00:00Z  4h45m0s
+2023-03-29T09:00:00Z - 2023-03-29T17:00:00Z  8h0m0s
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, Render(&out, "csv", Build(totals, nil, opts, Week), Options{}))
+	assert.Equal(t, `week,(uncategorized),total,expected,within working hours,outside working hours,untracked,utilization,free,longest free block,focus windows
+2023-W13,4.250000,4.250000,24.000000,3.250000,1.000000,20.750000,17.7,20.750000,8.000000,3
+total,4.250000,4.250000,24.000000,3.250000,1.000000,20.750000,17.7,20.750000,8.000000,3
+average,4.250000,4.250000,24.000000,3.250000,1.000000,20.750000,17.7,,,
+`, out.String())
+}
+
+func TestRenderSwitching(t *testing.T) {
+	src, err := source.ParseFixture(fixture)
+	require.NoError(t, err)
+	categories := []*core.Category{
+		{Name: "mail", Patterns: []*regexp.Regexp{regexp.MustCompile("read mail")}},
+		{Name: "meetings", Patterns: []*regexp.Regexp{regexp.MustCompile("meeting")}},
+	}
+	opts := core.Options{Location: time.UTC}
+	totals := core.Compute(src.Events, categories, opts)
+	r := Build(totals, categories, opts, Day)
+	r.AddSwitching(totals, core.SwitchingThresholds{MaxFragmentation: 0.4})
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", r, Options{}))
+	assert.Contains(t, out.String(), `Context switches per day:
+2023-03-27: 0 switches, average stretch 1h0m0s, 0.0 switches per hour
+2023-03-28: 1 switch, average stretch 1h7m30s, 0.4 switches per hour  (choppy)
+Total: 1 switch, average stretch 1h5m0s, 0.3 switches per hour
+`)
+}
+
+func TestRenderMeetings(t *testing.T) {
+	src, err := source.ParseFixture(`
+- summary: focus
+  start: 2023-03-27T08:00:00Z
+  end: 2023-03-27T09:00:00Z
+- summary: 1:1
+  start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T10:00:00Z
+  organizer: boss@example.com
+  attendees: [boss@example.com]
+- summary: customer call
+  start: 2023-03-27T10:00:00Z
+  end: 2023-03-27T11:00:00Z
+  attendees: [pm@example.com, a@acme.com, b@other.org]
+`)
+	require.NoError(t, err)
+	opts := core.Options{Location: time.UTC, InternalDomains: []string{"example.com"}}
+	totals := core.Compute(src.Events, nil, opts)
+	r := Build(totals, nil, opts, Day)
+	r.AddMeetings(totals)
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", r, Options{}))
+	assert.Contains(t, out.String(), `Time spent in meetings: 33.3% 1:1, 33.3% group, 33.3% alone
+Time spent per meeting size:
+33.3% alone
+33.3% 1:1
+33.3% 3-5
+ 0.0% 6-10
+ 0.0% 11+
+Time spent per organizer:
+33.3% boss@example.com
+Time spent with external domains:
+33.3% acme.com
+33.3% other.org
+`)
+}
+
+func TestRenderSeries(t *testing.T) {
+	src, err := source.ParseFixture(`
+- summary: standup
+  series: standup
+  start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T09:15:00Z
+- summary: standup
+  series: standup
+  start: 2023-03-28T09:00:00Z
+  end: 2023-03-28T09:15:00Z
+  response: declined
+- summary: standup
+  series: standup
+  start: 2023-03-29T09:00:00Z
+  end: 2023-03-29T09:25:00Z
+- summary: planning
+  series: planning
+  start: 2023-03-27T14:00:00Z
+  end: 2023-03-27T15:00:00Z
+- summary: one-off
+  start: 2023-03-27T16:00:00Z
+  end: 2023-03-27T16:20:00Z
+`)
+	require.NoError(t, err)
+	opts := core.Options{Location: time.UTC}
+	totals := core.Compute(src.Events, nil, opts)
+	r := Build(totals, nil, opts, Day)
+	r.AddSeries(totals)
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "text", r, Options{}))
+	assert.Contains(t, out.String(), `Time spent per recurring event:
+50.0% planning  1h0m0s in 1 instance, 1h0m0s on average, 0 declined
+33.3% standup  40m0s in 2 instances, 20m0s on average, 1 declined
+`)
+}
+
+func TestRenderSeriesAllDeclined(t *testing.T) {
+	src, err := source.ParseFixture(`
+- summary: standup
+  series: standup
+  start: 2023-03-27T09:00:00Z
+  end: 2023-03-27T09:15:00Z
+  response: declined
+`)
+	require.NoError(t, err)
+	opts := core.Options{Location: time.UTC}
+	totals := core.Compute(src.Events, nil, opts)
+	r := Build(totals, nil, opts, Day)
+	r.AddSeries(totals)
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, "json", r, Options{}))
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	series := got["series"].([]any)
+	require.Len(t, series, 1)
+	assert.EqualValues(t, 0, series[0].(map[string]any)["percent"])
+	assert.EqualValues(t, 1, series[0].(map[string]any)["declined"])
+}
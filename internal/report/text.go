@@ -0,0 +1,357 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/porridge/calendar-stats/internal/core"
+)
+
+// textWriter remembers the first error, so that rendering code need not check every write.
+type textWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (t *textWriter) printf(format string, a ...any) {
+	if t.err == nil {
+		_, t.err = fmt.Fprintf(t.w, format, a...)
+	}
+}
+
+func renderText(w io.Writer, r *Report, opts Options) error {
+	t := &textWriter{w: w}
+	if len(r.Days) > 0 {
+		t.printf("Time spent per day:\n")
+	}
+	for _, day := range r.Days {
+		t.printf("%v: %s%s\n", day.Date, formatDayTotal(opts.DecimalOutput, time.Duration(day.Seconds)), formatUtilization(day.Utilization, opts))
+	}
+	if len(r.Buckets) > 0 {
+		t.printf("Time spent per %s:\n", r.GroupBy)
+		for _, b := range r.Buckets {
+			t.printAmounts(b.Label, b.Amounts, r.Categories, opts)
+		}
+		t.printAmounts("Average per "+string(r.GroupBy), *r.Average, r.Categories, opts)
+	}
+	if r.Utilization != nil {
+		t.printf("Total: %s%s\n", formatDayTotal(opts.DecimalOutput, time.Duration(r.Total)), formatUtilization(r.Utilization, opts))
+	}
+	if r.Free != nil {
+		t.printFree(r, opts)
+	}
+	if r.Switching != nil {
+		t.printSwitching(r, opts)
+	}
+	if len(r.Categories) > 0 {
+		t.printf("Time spent per category:\n")
+		if isNested(r.Tree) {
+			t.printTree(r.Tree, "")
+		} else {
+			for _, category := range r.Categories {
+				t.printf("%4.1f%% %s\n", category.Percent, formatCategoryName(category.Name))
+			}
+		}
+	}
+	if r.Comparison != nil {
+		t.printComparison(r, opts)
+	}
+	for _, d := range r.Dimensions {
+		t.printf("Time spent per %s:\n", d.Name)
+		for _, tag := range d.Tags {
+			t.printf("%4.1f%% %s\n", tag.Percent, tag.Name)
+		}
+		if d.Untagged.Seconds > 0 {
+			t.printf("%4.1f%% (untagged)\n", d.Untagged.Percent)
+		}
+	}
+	if r.Meetings != nil {
+		t.printMeetings(r.Meetings)
+	}
+	if r.Series != nil {
+		t.printSeries(r.Series, opts)
+	}
+	if len(r.Tags) > 0 {
+		t.printf("Time spent per tag:\n")
+		for _, tag := range r.Tags {
+			t.printf("%4.1f%% #%s\n", tag.Percent, tag.Name)
+		}
+	}
+	// Without categories, all events are unrecognized, so there is no point listing them.
+	if len(r.Categories) > 0 && len(r.Unrecognized) > 0 {
+		t.printf("Unrecognized:\n")
+		for _, un := range r.Unrecognized {
+			t.printf("%s\n", formatUnrecognizedEvent(un, opts.ShowCalendars))
+		}
+	}
+	if r.Explanations != nil {
+		t.printExplanations(r.Explanations, opts)
+	}
+	return t.err
+}
+
+func (t *textWriter) printExplanations(explanations []Explanation, opts Options) {
+	var counted, excluded []Explanation
+	for _, e := range explanations {
+		if e.Excluded == "" {
+			counted = append(counted, e)
+		} else {
+			excluded = append(excluded, e)
+		}
+	}
+	calendarOf := func(e Explanation) string {
+		if opts.ShowCalendars {
+			return fmt.Sprintf("  (%s)", e.Calendar)
+		}
+		return ""
+	}
+	if len(counted) > 0 {
+		t.printf("Counted events:\n")
+	}
+	for _, e := range counted {
+		start, _ := time.Parse(time.RFC3339, e.CountedStart)
+		end, _ := time.Parse(time.RFC3339, e.CountedEnd)
+		scheduled := ""
+		if e.Fixed != 0 {
+			scheduled = fmt.Sprintf(" (fixed %s)", time.Duration(e.Fixed))
+		} else if Duration(end.Sub(start)) != e.Seconds {
+			scheduled = fmt.Sprintf(" (scheduled %s)", time.Duration(e.Seconds))
+		}
+		category := formatCategoryName(e.Category)
+		if e.Rule != "" {
+			category += " by " + e.Rule
+		}
+		t.printf("%s - %s%s  %s%s  => %s\n", e.CountedStart, e.CountedEnd, scheduled, e.Summary, calendarOf(e), category)
+	}
+	if len(excluded) > 0 {
+		t.printf("Excluded events:\n")
+	}
+	for _, e := range excluded {
+		t.printf("%s  %s  %s%s\n", e.Start, e.Excluded, e.Summary, calendarOf(e))
+	}
+}
+
+// printComparison prints the time spent per category in the other period and in the one of the report,
+// and how it changed. Categories without time spent in either are skipped.
+func (t *textWriter) printComparison(r *Report, opts Options) {
+	c := r.Comparison
+	format := func(d Duration) string {
+		return formatDayTotal(opts.DecimalOutput, time.Duration(d).Round(time.Second))
+	}
+	change := func(d Duration) string {
+		if d >= 0 {
+			return "+" + format(d)
+		}
+		return format(d)
+	}
+	t.printf("Compared with %s - %s:\n", c.Start.Format(time.RFC3339), c.End.Format(time.RFC3339))
+	for _, category := range c.Categories {
+		if category.Before.Seconds == 0 && category.After.Seconds == 0 {
+			continue
+		}
+		var relative string
+		switch {
+		case category.Appeared:
+			relative = "new"
+		case category.Disappeared:
+			relative = "gone"
+		default:
+			relative = fmt.Sprintf("%+.1f%%", *category.PercentChange)
+		}
+		t.printf("%s: %s (%.1f%%) -> %s (%.1f%%), %s (%s)\n", formatCategoryName(category.Name),
+			format(category.Before.Seconds), category.Before.Percent,
+			format(category.After.Seconds), category.After.Percent,
+			change(category.Change), relative)
+	}
+	total := fmt.Sprintf("Total: %s -> %s, %s", format(c.Total), format(r.Total), change(r.Total-c.Total))
+	if c.Total > 0 {
+		total += fmt.Sprintf(" (%+.1f%%)", float64(r.Total-c.Total)/float64(c.Total)*100)
+	}
+	t.printf("%s\n", total)
+}
+
+func isNested(tree []*CategoryNode) bool {
+	for _, node := range tree {
+		if len(node.Children) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// printTree prints the nodes and their descendants, each level indented more than the previous one.
+func (t *textWriter) printTree(nodes []*CategoryNode, indent string) {
+	for _, node := range nodes {
+		t.printf("%s%4.1f%% %s\n", indent, node.Percent, formatCategoryName(core.CategoryName(node.Name).Base()))
+		t.printTree(node.Children, indent+"  ")
+	}
+}
+
+func formatCategoryName(name string) string {
+	if name == string(core.Uncategorized) {
+		return "(uncategorized)"
+	}
+	return name
+}
+
+// printAmounts prints the total, followed by indented per-category totals, if there are any categories.
+func (t *textWriter) printAmounts(label string, a Amounts, categories []CategoryTotal, opts Options) {
+	format := func(d Duration) string {
+		return formatDayTotal(opts.DecimalOutput, time.Duration(d).Round(time.Second))
+	}
+	t.printf("%s: %s%s\n", label, format(a.Seconds), formatUtilization(a.Utilization, opts))
+	if len(categories) == 0 {
+		return
+	}
+	for _, category := range categories {
+		t.printf("  %s: %s\n", category.Name, format(a.Categories[category.Name]))
+	}
+	t.printf("  (uncategorized): %s\n", format(a.Uncategorized))
+}
+
+// printFree prints free time per day and in total, followed by the list of focus windows.
+func (t *textWriter) printFree(r *Report, opts Options) {
+	format := func(d Duration) string {
+		return formatDayTotal(opts.DecimalOutput, time.Duration(d).Round(time.Second))
+	}
+	describe := func(f *FreeTime) string {
+		return fmt.Sprintf("%s free, longest block %s, %s", format(f.Seconds), format(f.Longest), count(f.FocusWindows, "focus window"))
+	}
+	t.printf("Free working time per day:\n")
+	for _, day := range r.Days {
+		if day.Free != nil {
+			t.printf("%v: %s\n", day.Date, describe(day.Free))
+		}
+	}
+	t.printf("Total: %s\n", describe(r.Free))
+	if len(r.FocusWindows) > 0 {
+		t.printf("Focus windows of at least %s:\n", format(r.FocusBlock))
+	}
+	for _, w := range r.FocusWindows {
+		t.printf("%s - %s  %s\n", w.Start, w.End, format(w.Seconds))
+	}
+}
+
+// printSwitching prints how often categories changed per day and in total, marking choppy days.
+func (t *textWriter) printSwitching(r *Report, opts Options) {
+	describe := func(s *Switching) string {
+		ret := fmt.Sprintf("%s, average stretch %s, %.1f switches per hour",
+			count(s.Switches, "switch"), formatDayTotal(opts.DecimalOutput, time.Duration(s.AverageStretch).Round(time.Second)), s.Fragmentation)
+		if s.Choppy {
+			ret += "  (choppy)"
+		}
+		return ret
+	}
+	t.printf("Context switches per day:\n")
+	for _, day := range r.Days {
+		t.printf("%v: %s\n", day.Date, describe(day.Switching))
+	}
+	t.printf("Total: %s\n", describe(r.Switching))
+}
+
+func (t *textWriter) printSeries(series []Series, opts Options) {
+	format := func(d Duration) string {
+		return formatDayTotal(opts.DecimalOutput, time.Duration(d).Round(time.Second))
+	}
+	if len(series) > 0 {
+		t.printf("Time spent per recurring event:\n")
+	}
+	for _, s := range series {
+		t.printf("%4.1f%% %s  %s in %s, %s on average, %d declined\n",
+			s.Percent, s.Summary, format(s.Seconds), count(s.Attended, "instance"), format(s.Average), s.Declined)
+	}
+}
+
+// topOrganizers is the number of organizers listed in text reports.
+const topOrganizers = 10
+
+func (t *textWriter) printMeetings(m *Meetings) {
+	t.printf("Time spent in meetings: %.1f%% 1:1, %.1f%% group, %.1f%% alone\n", m.OneOnOne.Percent, m.Group.Percent, m.Alone.Percent)
+	t.printf("Time spent per meeting size:\n")
+	for _, size := range m.Sizes {
+		t.printf("%4.1f%% %s\n", size.Percent, size.Name)
+	}
+	if len(m.Organizers) > 0 {
+		t.printf("Time spent per organizer:\n")
+	}
+	for i, organizer := range m.Organizers {
+		if i == topOrganizers {
+			t.printf("(%d more)\n", len(m.Organizers)-topOrganizers)
+			break
+		}
+		t.printf("%4.1f%% %s\n", organizer.Percent, organizer.Name)
+	}
+	if len(m.ExternalDomains) > 0 {
+		t.printf("Time spent with external domains:\n")
+	}
+	for _, domain := range m.ExternalDomains {
+		t.printf("%4.1f%% %s\n", domain.Percent, domain.Name)
+	}
+}
+
+// count returns the number followed by the noun, in plural unless the number is 1.
+func count(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	if strings.HasSuffix(noun, "ch") {
+		return fmt.Sprintf("%d %ses", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatUtilization describes how the time spent compares with working hours, if there is a schedule.
+func formatUtilization(u *Utilization, opts Options) string {
+	if u == nil {
+		return ""
+	}
+	format := func(d Duration) string {
+		return formatDayTotal(opts.DecimalOutput, time.Duration(d).Round(time.Second))
+	}
+	ret := fmt.Sprintf("  (%.1f%% of %s expected, %s untracked", u.Percent, format(u.Expected), format(u.Untracked))
+	if u.Outside > 0 {
+		ret += fmt.Sprintf(", %s outside working hours", format(u.Outside))
+	}
+	return ret + ")"
+}
+
+func formatUnrecognizedEvent(event Event, showCalendar bool) string {
+	if event.Start == "" {
+		return "?"
+	}
+	formatted := fmt.Sprintf("%s %10s  %s", event.Start, time.Duration(event.Seconds).String(), event.Summary)
+	if showCalendar {
+		formatted += fmt.Sprintf("  (%s)", event.Calendar)
+	}
+	return formatted
+}
+
+func formatDayTotal(decimalOutput bool, d time.Duration) string {
+	if decimalOutput {
+		return formatHours(d)
+	} else {
+		return d.String()
+	}
+}
+
+// formatHours formats the duration as a decimal fraction of hours.
+func formatHours(d time.Duration) string {
+	return fmt.Sprintf("%f", float64(d)/float64(time.Hour))
+}
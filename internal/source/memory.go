@@ -0,0 +1,145 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"google.golang.org/api/calendar/v3"
+)
+
+func init() {
+	Register("fixture", func(arg string, _ Options) (EventSource, error) {
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return ParseFixture(string(data))
+	})
+}
+
+// Memory is a source of events kept in memory, mostly useful in tests.
+type Memory struct {
+	Events []*calendar.Event
+}
+
+// NewMemory returns a source serving the given events.
+func NewMemory(events ...*calendar.Event) *Memory {
+	return &Memory{Events: events}
+}
+
+func (m *Memory) List(_ context.Context, start, end time.Time) ([]*calendar.Event, error) {
+	return Overlapping(m.Events, start, end), nil
+}
+
+func (m *Memory) UpdateSummary(_ context.Context, id, summary string) error {
+	for _, e := range m.Events {
+		if e.Id == id {
+			e.Summary = summary
+			return nil
+		}
+	}
+	return fmt.Errorf("event %q not found", id)
+}
+
+// fixtureEvent is the YAML representation of an event in a fixture.
+type fixtureEvent struct {
+	Id        string `yaml:"id"`
+	Summary   string `yaml:"summary"`
+	Start     string `yaml:"start"`
+	End       string `yaml:"end"`
+	Date      string `yaml:"date"`
+	EventType string `yaml:"type"`
+	// Response, if set, makes the event an invitation with this response status of self.
+	Response string `yaml:"response"`
+	// Organizer, if set, makes the event an invitation from this address, accepted unless Response says otherwise.
+	Organizer string `yaml:"organizer"`
+	// Attendees are addresses of other attendees, who all accepted.
+	Attendees []string `yaml:"attendees"`
+	// Series is the ID of the recurring event which the event is an instance of.
+	Series string `yaml:"series"`
+}
+
+// ParseFixture returns a source serving events described by a YAML list such as:
+//
+//   - start: 2023-03-25T13:00:00Z
+//     end: 2023-03-25T13:30:00Z
+//     summary: read mail
+//   - date: 2023-03-26
+//     summary: holiday
+//   - start: 2023-03-27T10:00:00Z
+//     end: 2023-03-27T11:00:00Z
+//     summary: meeting
+//     response: declined
+//   - start: 2023-03-27T12:00:00Z
+//     end: 2023-03-27T12:30:00Z
+//     summary: 1:1
+//     organizer: boss@example.com
+//     attendees: [boss@example.com]
+//
+// Events are organized by self, unless a response or organizer is given.
+func ParseFixture(text string) (*Memory, error) {
+	var fixture []fixtureEvent
+	if err := yaml.Unmarshal([]byte(text), &fixture); err != nil {
+		return nil, err
+	}
+	m := &Memory{}
+	for i, f := range fixture {
+		e := &calendar.Event{
+			Id:               f.Id,
+			Summary:          f.Summary,
+			EventType:        f.EventType,
+			RecurringEventId: f.Series,
+			Start:            &calendar.EventDateTime{DateTime: f.Start},
+			End:              &calendar.EventDateTime{DateTime: f.End},
+		}
+		if e.Id == "" {
+			e.Id = fmt.Sprintf("fixture%d", i)
+		}
+		if f.Date != "" {
+			d, err := time.Parse("2006-01-02", f.Date)
+			if err != nil {
+				return nil, fmt.Errorf("event %d: %w", i, err)
+			}
+			e.Start = &calendar.EventDateTime{Date: f.Date}
+			e.End = &calendar.EventDateTime{Date: d.AddDate(0, 0, 1).Format("2006-01-02")}
+		} else if _, _, ok := Times(e); !ok {
+			return nil, fmt.Errorf("event %d: start and end must be RFC 3339 times", i)
+		}
+		if f.Response != "" || f.Organizer != "" || len(f.Attendees) > 0 {
+			response := f.Response
+			if response == "" {
+				response = "accepted"
+			}
+			e.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: response}}
+		}
+		switch {
+		case f.Organizer != "":
+			e.Organizer = &calendar.EventOrganizer{Email: f.Organizer}
+		case f.Response == "":
+			e.Organizer = &calendar.EventOrganizer{Self: true}
+		}
+		for _, email := range f.Attendees {
+			e.Attendees = append(e.Attendees, &calendar.EventAttendee{Email: email, ResponseStatus: "accepted"})
+		}
+		m.Events = append(m.Events, e)
+	}
+	return m, nil
+}
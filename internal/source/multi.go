@@ -0,0 +1,138 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// calendarProperty is the private extended property which records the calendar an event was read from.
+const calendarProperty = "calendarStatsCalendar"
+
+// CalendarOf returns the name of the calendar an event was read from, or empty string if not known.
+func CalendarOf(e *calendar.Event) string {
+	if e.ExtendedProperties == nil {
+		return ""
+	}
+	return e.ExtendedProperties.Private[calendarProperty]
+}
+
+// SetCalendar records the name of the calendar an event was read from.
+func SetCalendar(e *calendar.Event, name string) {
+	if e.ExtendedProperties == nil {
+		e.ExtendedProperties = &calendar.EventExtendedProperties{}
+	}
+	if e.ExtendedProperties.Private == nil {
+		e.ExtendedProperties.Private = make(map[string]string)
+	}
+	e.ExtendedProperties.Private[calendarProperty] = name
+}
+
+type namedSource struct {
+	name string
+	src  EventSource
+}
+
+// Multi reads events from several named sources concurrently.
+type Multi struct {
+	sources []namedSource
+}
+
+// Add makes Multi read events from src as well, labelling them with the given calendar name.
+func (m *Multi) Add(name string, src EventSource) {
+	m.sources = append(m.sources, namedSource{name: name, src: src})
+}
+
+// Lookup returns the source added with the given name.
+func (m *Multi) Lookup(name string) (EventSource, bool) {
+	for _, s := range m.sources {
+		if s.name == name {
+			return s.src, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of sources, in the order they were added.
+func (m *Multi) Names() []string {
+	var names []string
+	for _, s := range m.sources {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// List returns events from all sources, labelled with the name of the calendar they came from.
+// An event present in several calendars is returned once, as read from the first of them.
+func (m *Multi) List(ctx context.Context, start, end time.Time) ([]*calendar.Event, error) {
+	results := make([][]*calendar.Event, len(m.sources))
+	errs := make([]error, len(m.sources))
+	var wg sync.WaitGroup
+	for i, s := range m.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.src.List(ctx, start, end)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("calendar %q: %w", s.name, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var events []*calendar.Event
+	seen := make(map[string]bool)
+	for i, s := range m.sources {
+		for _, e := range results[i] {
+			key := dedupKey(e)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			SetCalendar(e, s.name)
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// dedupKey identifies an event across calendars.
+// Instances of a recurring event share the iCalUID, so the original start time tells them apart.
+func dedupKey(e *calendar.Event) string {
+	key := e.ICalUID
+	if key == "" {
+		key = "id:" + e.Id
+	}
+	when := e.Start
+	if e.OriginalStartTime != nil {
+		when = e.OriginalStartTime
+	}
+	if when != nil {
+		if t, err := parseEventDateTime(when); err == nil {
+			key += fmt.Sprintf("@%d", t.Unix())
+		}
+	}
+	return key
+}
@@ -0,0 +1,127 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package source defines where calendar events are read from.
+package source
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// DefaultKind is the kind of source assumed when a specification does not name a registered one.
+const DefaultKind = "google"
+
+// EventSource provides calendar events.
+type EventSource interface {
+	// List returns events which overlap the given time range.
+	List(ctx context.Context, start, end time.Time) ([]*calendar.Event, error)
+}
+
+// Updater is implemented by sources whose events can be modified.
+type Updater interface {
+	// UpdateSummary changes the summary of the event with the given ID.
+	UpdateSummary(ctx context.Context, id, summary string) error
+}
+
+// Options are passed to every factory, which uses the ones relevant to it.
+type Options struct {
+	// Self lists email addresses of the calendar owner, for sources which cannot tell on their own.
+	Self []string
+}
+
+// Factory creates a source, given the part of its specification after the colon.
+type Factory func(arg string, opts Options) (EventSource, error)
+
+var factories = make(map[string]Factory)
+
+// Register makes a kind of source available to Open.
+func Register(kind string, factory Factory) {
+	if _, ok := factories[kind]; ok {
+		panic(fmt.Sprintf("source kind %q registered twice", kind))
+	}
+	factories[kind] = factory
+}
+
+// Kinds returns the names of registered kinds of sources, in alphabetical order.
+func Kinds() []string {
+	var kinds []string
+	for kind := range factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Open creates the source described by spec, which has the form "kind:arg".
+// A spec which does not start with a registered kind is passed to the DefaultKind factory as a whole,
+// so that plain Google calendar IDs keep working.
+func Open(spec string, opts Options) (EventSource, error) {
+	kind, arg, found := strings.Cut(spec, ":")
+	factory, ok := factories[kind]
+	if !found || !ok {
+		kind, arg = DefaultKind, spec
+		factory, ok = factories[kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown source kind in %q", spec)
+		}
+	}
+	src, err := factory(arg, opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s source %q: %w", kind, arg, err)
+	}
+	return src, nil
+}
+
+// Overlapping returns those events which overlap the given time range.
+// Events whose times cannot be determined are kept.
+func Overlapping(events []*calendar.Event, start, end time.Time) []*calendar.Event {
+	var ret []*calendar.Event
+	for _, e := range events {
+		evStart, evEnd, ok := Times(e)
+		if ok && (!evStart.Before(end) || !evEnd.After(start)) {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// Times returns the start and end of an event, which for all-day events are local midnights.
+// It returns false if the event has no valid start or end.
+func Times(e *calendar.Event) (time.Time, time.Time, bool) {
+	if e.Start == nil || e.End == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	start, err1 := parseEventDateTime(e.Start)
+	end, err2 := parseEventDateTime(e.End)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+func parseEventDateTime(dt *calendar.EventDateTime) (time.Time, error) {
+	if dt.DateTime == "" {
+		return time.ParseInLocation("2006-01-02", dt.Date, time.Local)
+	}
+	return time.Parse(time.RFC3339, dt.DateTime)
+}
@@ -0,0 +1,126 @@
+// calendar-stats, a program to compute statistics from Google calendars.
+// Copyright (C) 2023 Marcin Owsiany <marcin@owsiany.pl>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/calendar/v3"
+)
+
+type argSource struct {
+	arg string
+}
+
+func (n *argSource) List(context.Context, time.Time, time.Time) ([]*calendar.Event, error) {
+	return nil, nil
+}
+
+func TestOpen(t *testing.T) {
+	Register(DefaultKind, func(arg string, _ Options) (EventSource, error) {
+		return &argSource{arg: arg}, nil
+	})
+	defer delete(factories, DefaultKind)
+
+	tests := []struct {
+		spec string
+		want EventSource
+	}{
+		{spec: "primary", want: &argSource{arg: "primary"}},
+		{spec: "google:work@example.com", want: &argSource{arg: "work@example.com"}},
+		{spec: "unknown:thing", want: &argSource{arg: "unknown:thing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Open(tt.spec, Options{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, err := Open("fixture:does-not-exist.yaml", Options{})
+	assert.ErrorContains(t, err, "cannot open fixture source")
+}
+
+func TestMemory(t *testing.T) {
+	m, err := ParseFixture(`
+- id: a
+  start: 2023-03-25T13:00:00Z
+  end: 2023-03-25T14:00:00Z
+  summary: first
+- id: b
+  start: 2023-03-26T13:00:00Z
+  end: 2023-03-26T14:00:00Z
+  summary: second
+`)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, m.UpdateSummary(ctx, "b", "updated"))
+	assert.Error(t, m.UpdateSummary(ctx, "c", "missing"))
+
+	events, err := m.List(ctx, time.Date(2023, 3, 25, 13, 30, 0, 0, time.UTC), time.Date(2023, 3, 26, 13, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "first", events[0].Summary)
+
+	events, err = m.List(ctx, time.Date(2023, 3, 26, 0, 0, 0, 0, time.UTC), time.Date(2023, 3, 27, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "updated", events[0].Summary)
+}
+
+func TestMulti(t *testing.T) {
+	shared := func(start string) *calendar.Event {
+		return &calendar.Event{
+			Id:      "x",
+			ICalUID: "shared",
+			Summary: "planning",
+			Start:   &calendar.EventDateTime{DateTime: start},
+			End:     &calendar.EventDateTime{DateTime: "2023-03-25T15:00:00Z"},
+		}
+	}
+	work, err := ParseFixture(`
+- start: 2023-03-25T13:00:00Z
+  end: 2023-03-25T13:30:00Z
+  summary: mail
+`)
+	require.NoError(t, err)
+	work.Events = append(work.Events, shared("2023-03-25T14:00:00Z"))
+	team := NewMemory(shared("2023-03-25T15:00:00+01:00"), &calendar.Event{
+		Id:      "y",
+		Summary: "retro",
+		Start:   &calendar.EventDateTime{DateTime: "2023-03-25T16:00:00Z"},
+		End:     &calendar.EventDateTime{DateTime: "2023-03-25T17:00:00Z"},
+	})
+
+	m := &Multi{}
+	m.Add("work", work)
+	m.Add("team", team)
+	events, err := m.List(context.Background(), time.Date(2023, 3, 25, 0, 0, 0, 0, time.UTC), time.Date(2023, 3, 26, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Summary+" "+CalendarOf(e))
+	}
+	assert.Equal(t, []string{"mail work", "planning work", "retro team"}, got)
+	src, ok := m.Lookup("team")
+	assert.True(t, ok)
+	assert.Same(t, team, src)
+}
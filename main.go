@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -29,9 +30,9 @@ import (
 	"github.com/porridge/calendar-stats/internal/core"
 	"github.com/porridge/calendar-stats/internal/flags"
 	"github.com/porridge/calendar-stats/internal/io"
-	"github.com/porridge/calendar-stats/internal/ordererd"
+	"github.com/porridge/calendar-stats/internal/report"
+	"github.com/porridge/calendar-stats/internal/source"
 	"github.com/snabb/isoweek"
-	"google.golang.org/api/calendar/v3"
 )
 
 var notice string = `
@@ -49,48 +50,152 @@ Google Calendar is a trademark of Google LLC.
 
 func main() {
 	configFile := flag.String("config", "config.yaml", "Name of configuration file to read.")
-	source := flag.String("source", "primary", "Name of Google Calendar to read.")
+	sourceSpecs := []string{"primary"}
+	sources := flags.ListValue(&sourceSpecs)
+	flag.Var(sources, "source", "Where to read events from, in the form KIND:ARG. "+
+		"Known kinds are: "+strings.Join(source.Kinds(), ", ")+". "+
+		"For example google:primary, ics:calendar.ics, cache:events.json or fixture:events.yaml. "+
+		"A value without a known kind is the name of a Google Calendar to read. "+
+		"May be repeated or set to a comma-separated list, to combine events from several calendars.")
+	flag.Var(flags.PrefixValue(sources, "ics:"), "source-file", "Deprecated, same as -source ics:FILE.")
 	weekCount := flag.Int("weeks", 0, "Shortcut way to set -start to beginning of week this many weeks before the current one. If set to non-zero value, takes precedecnce over -start.")
 	end := time.Now()
 	start := getWeekStart(0, end)
 	flag.Var(flags.TimeValue(&start), "start", "Start time. Defaults to beginning of current week. Use any unambiguous format supported by https://github.com/araddon/dateparse")
 	flag.Var(flags.TimeValue(&end), "end", "End time. Defaults to now. Use any unambiguous format supported by https://github.com/araddon/dateparse")
+	var compareStart, compareEnd time.Time
+	flag.Var(flags.TimeValue(&compareStart), "compare-start", "If set, also compare time spent per category with the period starting at this time. Same format as -start.")
+	flag.Var(flags.TimeValue(&compareEnd), "compare-end", "End of the period to compare with. Defaults to -compare-start plus the length of the analyzed period.")
 
 	cacheFileName := flag.String("cache", "", "If not empty, name of json file to use as event cache. "+
 		"If file does not exist, it will be created and fetched events will be stored there. "+
-		"Otherwise, events will be loaded from this file rather than fetched from Google Calendar.")
+		"Otherwise, events will be loaded from this file for the time ranges it covers, and only the missing ones will be fetched.")
+	cacheTTL := flag.Duration("cache-ttl", 0, "If not zero, events in -cache which were fetched longer ago than this are fetched again.")
+	storeDir := flag.String("store", "", "If not empty, name of directory in which to keep a copy of each Google calendar. "+
+		"Only changes made since the previous run are then fetched, and any time range after the earliest one requested is served from the copy.")
+	format := flag.String("format", "text", "Output format, one of: "+strings.Join(report.Formats(), ", ")+".")
+	groupByName := flag.String("group-by", "day", "Period to sum up daily totals over, one of: "+strings.Join(report.Periods(), ", ")+".")
 	decimalOutput := flag.Bool("decimal-output", false, "If true, print daily totals as decimal fractions rather than XhYmZs Duration format.")
+	focusBlock := flag.Duration("focus-block", time.Hour, "Shortest free stretch of working hours which counts as a focus window. Only used when working hours are configured.")
+	meetings := flag.Bool("meetings", false, "If true, also report time spent per meeting size, organizer and external domain of attendees, and per event type.")
+	series := flag.Bool("series", false, "If true, also report time spent per recurring event, with the number of instances attended and declined.")
+	switching := flag.Bool("switches", false, "If true, also report how often the category of events changed on each day, flagging days which exceed the thresholds in the configuration file.")
+	explain := flag.Bool("explain", false, "If true, also list each event with the times it was counted between and the rule which categorized it, or the reason it was not counted.")
+	noStretch := flag.Bool("no-stretch", false, "If true, count events with their scheduled duration, ignoring stretching rules.")
 	correctionsFileName := flag.String("corrections", "", "Name of file to: apply event summary corrections from at start, and save unrecognized events to at the end.")
+	var selfEmails []string
+	flag.Var(flags.ListValue(&selfEmails), "self", "Comma-separated list of your email addresses, used to find your responses to invitations in ics sources.")
 
 	flags.Parse(notice)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "source-file" {
+			log.Print("The -source-file parameter is deprecated, use -source ics:FILE instead.")
+		}
+	})
+
+	if args := flag.Args(); len(args) > 0 {
+		runCommand(args, *configFile)
+		return
+	}
 
 	if *weekCount != 0 {
 		start = getWeekStart(*weekCount, end)
 	}
+	if !compareStart.IsZero() && compareEnd.IsZero() {
+		compareEnd = compareStart.Add(end.Sub(start))
+	}
+	groupBy, err := report.ParsePeriod(*groupByName)
+	if err != nil {
+		log.Fatalf("Invalid -group-by value: %s", err)
+	}
 
 	ctx := context.Background()
-	err := maybeApplyCorrections(ctx, *source, *correctionsFileName)
+	calendars := &source.Multi{}
+	for _, spec := range sourceSpecs {
+		src, err := source.Open(spec, source.Options{Self: selfEmails})
+		if err != nil {
+			log.Fatalf("Failed to open event source: %s", err)
+		}
+		if *storeDir != "" {
+			src = io.NewSyncedSource(src, *storeDir)
+		}
+		calendars.Add(spec, src)
+	}
+	err = maybeApplyCorrections(ctx, calendars, *correctionsFileName)
 	if err != nil {
 		log.Fatalf("Failed to apply corrections: %s", err)
 	}
-	events, err := io.GetEvents(ctx, *source, start, end, *cacheFileName)
+	var src source.EventSource = calendars
+	if *cacheFileName != "" {
+		src = io.NewCachedSource(src, *cacheFileName, strings.Join(sourceSpecs, ","), *cacheTTL)
+	}
+	listStart, listEnd := start, end
+	if !compareStart.IsZero() {
+		listStart, listEnd = earliest(start, compareStart), latest(end, compareEnd)
+	}
+	events, err := src.List(ctx, listStart, listEnd)
 	if err != nil {
 		log.Fatalf("Failed to retrieve events: %s", err)
 	}
-	if len(events) == 0 {
+	if len(events) == 0 && *format == "text" {
 		fmt.Println("No events found.")
 		return
 	}
-	categories, err := config.Read(*configFile)
+	cfg, err := config.Read(*configFile)
 	if os.IsNotExist(err) {
 		log.Printf("Could not read config file %q, cannot categorize events: %s", *configFile, err)
+		cfg = config.Default()
 	} else if err != nil {
 		log.Fatalf("Could not read config file %q: %s", *configFile, err)
 	}
 
-	unrecognized := analyzeAndPrint(events, categories, *decimalOutput)
+	opts := core.Options{
+		Location:        time.Local,
+		Start:           start,
+		End:             end,
+		Stretch:         cfg.Stretch,
+		Dimensions:      cfg.Dimensions,
+		DescriptionTags: cfg.DescriptionTags,
+		Policy:          cfg.Policy,
+		AllDay:          cfg.AllDay,
+		WorkingDays:     cfg.WorkingDays,
+		Schedule:        cfg.Schedule,
+		FocusBlock:      *focusBlock,
+		InternalDomains: cfg.InternalDomains,
+	}
+	if *meetings {
+		opts.Dimensions = append(slices.Clone(opts.Dimensions), core.EventTypeDimension)
+	}
+	if *noStretch {
+		opts.Stretch = nil
+	}
+	totals := core.Compute(events, cfg.Categories, opts)
+	renderOpts := report.Options{DecimalOutput: *decimalOutput, ShowCalendars: len(sourceSpecs) > 1}
+	rep := report.Build(totals, cfg.Categories, opts, groupBy)
+	if !compareStart.IsZero() {
+		compareOpts := opts
+		compareOpts.Start, compareOpts.End = compareStart, compareEnd
+		rep.Compare(report.Build(core.Compute(events, cfg.Categories, compareOpts), cfg.Categories, compareOpts, report.Day))
+	}
+	if *meetings {
+		rep.AddMeetings(totals)
+	}
+	if *series {
+		rep.AddSeries(totals)
+	}
+	if *switching {
+		rep.AddSwitching(totals, cfg.Switching)
+	}
+	if *explain {
+		rep.Explain(core.Explain(events, cfg.Categories, opts))
+	}
+	err = report.Render(os.Stdout, *format, rep, renderOpts)
+	if err != nil {
+		log.Fatalf("Failed to print report: %s", err)
+	}
 
 	if *correctionsFileName != "" {
+		unrecognized := totals.Unrecognized
 		sort.Slice(unrecognized, func(i, j int) bool { return strings.ToLower(unrecognized[i].Summary) < strings.ToLower(unrecognized[j].Summary) })
 		err = io.SaveUnrecognized(*correctionsFileName, unrecognized)
 		if err != nil {
@@ -99,38 +204,35 @@ func main() {
 	}
 }
 
-func analyzeAndPrint(events []*calendar.Event, categories []*core.Category, decimalOutput bool) []*calendar.Event {
-	dayTotals, categoryTotals, unrecognized := core.ComputeTotals(events, categories, time.Local)
-	days := ordererd.KeysOfMap(dayTotals, ordererd.CivilDates)
-	var total time.Duration
-	if len(days) > 0 {
-		fmt.Println("Time spent per day:")
-	}
-	for _, day := range days {
-		total += dayTotals[day]
-		value := formatDayTotal(decimalOutput, dayTotals[day])
-		fmt.Printf("%v: %s\n", day, value)
-	}
-	if len(categories) == 0 {
-		return unrecognized
-	}
-	fmt.Println("Time spent per category:")
-	for _, category := range categories {
-		catName := category.Name
-		val := categoryTotals[catName]
-		fraction := (float64(val) / float64(total)) * 100
-		if catName == core.Uncategorized {
-			catName = "(uncategorized)"
+// runCommand runs a command given after the flags, instead of computing statistics.
+func runCommand(args []string, configFile string) {
+	switch {
+	case len(args) >= 2 && len(args) <= 3 && args[0] == "config" && args[1] == "check":
+		if len(args) == 3 {
+			configFile = args[2]
 		}
-		fmt.Printf("%4.1f%% %s\n", fraction, catName)
-	}
-	if len(unrecognized) > 0 {
-		fmt.Println("Unrecognized:")
-		for _, un := range unrecognized {
-			fmt.Println(formatUnrecognizedEvent(un))
+		if _, err := config.Read(configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+		fmt.Printf("%s: OK\n", configFile)
+	default:
+		log.Fatalf("Unknown command %q, the only one supported is \"config check [FILE]\".", strings.Join(args, " "))
+	}
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
 	}
-	return unrecognized
+	return b
 }
 
 // getWeekStart returns the time of beginning of week that is weekCount weeks before end.
@@ -140,7 +242,7 @@ func getWeekStart(weekCount int, end time.Time) time.Time {
 	return isoweek.StartTime(year, week, time.Local)
 }
 
-func maybeApplyCorrections(ctx context.Context, source, correctionsFileName string) error {
+func maybeApplyCorrections(ctx context.Context, calendars *source.Multi, correctionsFileName string) error {
 	if correctionsFileName == "" {
 		return nil
 	}
@@ -156,7 +258,20 @@ func maybeApplyCorrections(ctx context.Context, source, correctionsFileName stri
 	}
 	log.Printf("Updating summary of %d events...\n", len(corrections.Corrections))
 	for _, correction := range corrections.Corrections {
-		err = io.MaybeUpdateSummary(ctx, source, correction.Id, correction.Summary)
+		calendarName := correction.Calendar
+		if calendarName == "" {
+			// Corrections saved before multiple calendars were supported.
+			calendarName = calendars.Names()[0]
+		}
+		src, ok := calendars.Lookup(calendarName)
+		if !ok {
+			return fmt.Errorf("event %q comes from calendar %q, which is not among the sources", correction.Id, calendarName)
+		}
+		updater, ok := src.(source.Updater)
+		if !ok {
+			return fmt.Errorf("calendar %q does not support updating events", calendarName)
+		}
+		err = updater.UpdateSummary(ctx, correction.Id, correction.Summary)
 		if err != nil {
 			return fmt.Errorf("failed to update summary of event %q: %w", correction.Id, err)
 		}
@@ -164,23 +279,3 @@ func maybeApplyCorrections(ctx context.Context, source, correctionsFileName stri
 	log.Println("Summaries updated.")
 	return nil
 }
-
-func formatUnrecognizedEvent(event *calendar.Event) string {
-	if event.Start == nil || event.End == nil {
-		return "?"
-	}
-	start, err1 := time.Parse(time.RFC3339, event.Start.DateTime)
-	end, err2 := time.Parse(time.RFC3339, event.End.DateTime)
-	if err1 != nil || err2 != nil {
-		return "?"
-	}
-	return fmt.Sprintf("%s %10s  %s", event.Start.DateTime, end.Sub(start).String(), event.Summary)
-}
-
-func formatDayTotal(decimalOutput bool, d time.Duration) string {
-	if decimalOutput {
-		return fmt.Sprintf("%f", float64(d)/float64(time.Hour))
-	} else {
-		return d.String()
-	}
-}